@@ -4,6 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,7 +17,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
+
 	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/lang"
 	"talk-to-ugur-back/models/db"
 )
 
@@ -25,19 +32,104 @@ type Client struct {
 	temperature  float64
 	systemPrompt string
 	promptPath   string
-	emotions     []string
+	emotions     *emotion.Set
+	lexicon      emotion.Lexicon
+	override     bool
+	segments     bool
+	maxSegments  int
+	vision       bool
+	capture      bool
 	httpClient   *http.Client
+	// streamClient has no overall timeout; streams are bounded by the
+	// caller's context instead.
+	streamClient *http.Client
 }
 
+var (
+	ErrRefused    = errors.New("openai api refused to answer")
+	ErrEmptyReply = errors.New("openai api returned empty content")
+)
+
 type Reply struct {
 	Text    string
 	Emotion string
+	// Language is the language detected in Text, empty when undetermined.
+	Language string
+	// LanguageMismatch reports that Language is not the one the reply was
+	// asked for. GenerateReply sets it only when its retry failed too.
+	LanguageMismatch bool
+	// Structured reports whether the model answered with the expected JSON
+	// object. When false, Text is the raw answer and Emotion a fallback.
+	Structured bool
+	// Model is the model that wrote the reply and PromptVersion identifies
+	// the persona prompt it was given, so replies can be compared across
+	// prompt and model changes.
+	Model         string
+	PromptVersion string
+	// Prompt is the request that produced the reply. It is nil unless prompt
+	// capture is enabled.
+	Prompt *Prompt
+	// Segments is set in segments mode: the reply split into bubbles with
+	// their own emotions. Text joins them and Emotion is the first one's.
+	Segments []Segment
+}
+
+// Prompt is a chat completion request exactly as it was last sent to the
+// provider for a reply, i.e. after the temperature and response format
+// fallbacks were applied.
+type Prompt struct {
+	Model            string
+	Temperature      float64
+	ResponseFormat   string
+	SystemPrompt     string
+	SystemPromptHash string
+	HistoryIDs       []pgtype.UUID
+	Request          []byte
+}
+
+// ReplyOptions carries per-request inputs beyond the stored history.
+type ReplyOptions struct {
+	Attachments map[pgtype.UUID][]Attachment
+	// Language is the language code the reply must be written in. Empty
+	// leaves the choice to the model.
+	Language string
+}
+
+// Attachment is an image sent by the visitor alongside a user message.
+type Attachment struct {
+	ContentType string
+	Data        []byte
 }
 
 type chatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-	Refusal string `json:"refusal,omitempty"`
+	Role    string        `json:"role"`
+	Content string        `json:"content"`
+	Refusal string        `json:"refusal,omitempty"`
+	Parts   []contentPart `json:"-"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+func (m chatMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Parts) == 0 {
+		type plainMessage chatMessage
+		return json.Marshal(plainMessage(m))
+	}
+	return json.Marshal(struct {
+		Role    string        `json:"role"`
+		Content []contentPart `json:"content"`
+	}{
+		Role:    m.Role,
+		Content: m.Parts,
+	})
 }
 
 type chatRequest struct {
@@ -75,11 +167,24 @@ type jsonSchema struct {
 }
 
 type aiJSON struct {
-	Reply   string `json:"reply"`
-	Emotion string `json:"emotion"`
+	Reply    string      `json:"reply"`
+	Emotion  string      `json:"emotion"`
+	Segments []aiSegment `json:"segments"`
 }
 
-func NewClient(cfg *config.Config) *Client {
+func NewClient(cfg *config.Config) (*Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lexicon, err := emotion.LoadLexicon(cfg.AIEmotionLexiconPath)
+	if err != nil {
+		return nil, fmt.Errorf("load AI_EMOTION_LEXICON_PATH: %w", err)
+	}
+	definitions, err := emotion.LoadDefinitions(cfg.AIEmotionDefinitionsPath, cfg.AIEmotions)
+	if err != nil {
+		return nil, fmt.Errorf("load AI_EMOTION_DEFINITIONS_PATH: %w", err)
+	}
 	return &Client{
 		baseURL:      strings.TrimRight(cfg.OpenAIBaseURL, "/"),
 		apiKey:       cfg.OpenAIAPIKey,
@@ -87,35 +192,102 @@ func NewClient(cfg *config.Config) *Client {
 		temperature:  cfg.OpenAITemperature,
 		systemPrompt: cfg.AISystemPrompt,
 		promptPath:   cfg.AISystemPromptPath,
-		emotions:     cfg.AIEmotions,
+		emotions:     emotion.NewSet(definitions),
+		lexicon:      lexicon,
+		override:     cfg.AIEmotionOverride,
+		segments:     cfg.AISegmentsEnabled,
+		maxSegments:  max(cfg.AISegmentsMax, 1),
+		vision:       cfg.AIVisionEnabled,
+		capture:      cfg.AIPromptCaptureEnabled,
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout:   60 * time.Second,
+			Transport: transport,
+		},
+		streamClient: &http.Client{
+			Transport: transport,
 		},
+	}, nil
+}
+
+// newTransport picks where chat requests go: the configured OpenAI-compatible
+// API, or a recorded transcript for offline runs. Either can be recorded.
+func newTransport(cfg *config.Config) (http.RoundTripper, error) {
+	var transport http.RoundTripper
+	switch strings.ToLower(strings.TrimSpace(cfg.AIProvider)) {
+	case "", "openai":
+		if strings.TrimSpace(cfg.OpenAIAPIKey) == "" {
+			return nil, errors.New("missing OPENAI_API_KEY")
+		}
+		transport = http.DefaultTransport
+	case "replay":
+		replayer, err := NewReplayer(cfg.AIReplayPath)
+		if err != nil {
+			return nil, fmt.Errorf("load AI_REPLAY_PATH: %w", err)
+		}
+		transport = replayer
+	default:
+		return nil, fmt.Errorf("unknown AI_PROVIDER %q", cfg.AIProvider)
 	}
+	if path := strings.TrimSpace(cfg.AIRecordPath); path != "" {
+		transport = NewRecorder(transport, path)
+	}
+	return transport, nil
 }
 
-func (c *Client) GenerateReply(ctx context.Context, history []db.ChatMessage) (Reply, error) {
-	messages := make([]chatMessage, 0, len(history)+1)
+func (c *Client) GenerateReply(ctx context.Context, history []db.ChatMessage, opts ReplyOptions) (Reply, error) {
+	messages := c.buildMessages(history, opts)
 
-	emotionList := strings.Join(c.emotions, ", ")
-	formatInstruction := fmt.Sprintf("Respond ONLY with valid JSON and no extra text. The JSON must have keys 'emotion' and 'reply' in that order. 'emotion' must be one of: %s.", emotionList)
-	systemPrompt := strings.TrimSpace(c.systemPrompt)
-	if prompt := c.loadPromptFromFile(); prompt != "" {
-		systemPrompt = prompt
+	reply, req, err := c.generate(ctx, messages)
+	if err != nil {
+		return Reply{}, err
+	}
+	if !languageMismatch(opts.Language, reply.Language) {
+		return c.withPrompt(reply, req, history), nil
 	}
+
+	// The model ignored the language instruction; ask once more explicitly and
+	// keep the first answer if the retry fails too.
 	messages = append(messages, chatMessage{
 		Role:    "system",
-		Content: strings.TrimSpace(systemPrompt + "\n\n" + formatInstruction),
+		Content: fmt.Sprintf("Your previous answer was not in %s. Answer the last visitor message again, entirely in %s.", lang.Name(opts.Language), lang.Name(opts.Language)),
 	})
+	retry, retryReq, err := c.generate(ctx, messages)
+	if err != nil || languageMismatch(opts.Language, retry.Language) {
+		reply.LanguageMismatch = true
+		return c.withPrompt(reply, req, history), nil
+	}
+	return c.withPrompt(retry, retryReq, history), nil
+}
 
-	for _, msg := range history {
-		role := msg.Role
-		switch role {
-		case "user", "assistant":
-			messages = append(messages, chatMessage{Role: role, Content: msg.Content})
+// Replay sends a captured request to the configured provider again, without
+// streaming, and parses the answer like GenerateReply. A non-empty model
+// replaces the one stored in the request.
+func (c *Client) Replay(ctx context.Context, request []byte, model string) (Reply, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(request, &body); err != nil {
+		return Reply{}, fmt.Errorf("invalid captured request: %w", err)
+	}
+	body["stream"] = json.RawMessage("false")
+	if model != "" {
+		encoded, err := json.Marshal(model)
+		if err != nil {
+			return Reply{}, err
 		}
+		body["model"] = encoded
 	}
 
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Reply{}, err
+	}
+	parsed, err := c.doChatPayload(ctx, payload)
+	if err != nil {
+		return Reply{}, err
+	}
+	return c.parseReply(parsed)
+}
+
+func (c *Client) generate(ctx context.Context, messages []chatMessage) (Reply, chatRequest, error) {
 	reqBody := chatRequest{
 		Model:          c.model,
 		Messages:       messages,
@@ -143,10 +315,15 @@ func (c *Client) GenerateReply(ctx context.Context, history []db.ChatMessage) (R
 			}
 		}
 		if err != nil {
-			return Reply{}, err
+			return Reply{}, reqBody, err
 		}
 	}
 
+	reply, err := c.parseReply(parsed)
+	return reply, reqBody, err
+}
+
+func (c *Client) parseReply(parsed chatResponse) (Reply, error) {
 	if len(parsed.Choices) == 0 {
 		return Reply{}, errors.New("openai api returned no choices")
 	}
@@ -154,51 +331,96 @@ func (c *Client) GenerateReply(ctx context.Context, history []db.ChatMessage) (R
 	content := strings.TrimSpace(parsed.Choices[0].Message.Content)
 	if content == "" {
 		if strings.TrimSpace(parsed.Choices[0].Message.Refusal) != "" {
-			return Reply{}, errors.New("openai api refused to answer")
+			return Reply{}, ErrRefused
 		}
-		return Reply{}, errors.New("openai api returned empty content")
+		return Reply{}, ErrEmptyReply
 	}
+	return c.parseContent(content), nil
+}
 
+// parseContent reads a model answer in either output shape. In segments mode
+// a single reply becomes one segment, and so does an unstructured answer.
+func (c *Client) parseContent(content string) Reply {
 	aiPayload, ok := parseAIJSON(content)
+	if ok && len(aiPayload.Segments) > 0 {
+		segments := make([]Segment, 0, len(aiPayload.Segments))
+		for _, segment := range aiPayload.Segments {
+			segments = append(segments, Segment{Text: segment.Text, Emotion: segment.Emotion})
+		}
+		if reply := c.segmentedReply(segments); reply.Text != "" {
+			return reply
+		}
+	}
 	if !ok || aiPayload.Reply == "" {
-		return Reply{
-			Text:    content,
-			Emotion: fallbackEmotion(c.emotions),
-		}, nil
+		reply := Reply{
+			Text:     content,
+			Emotion:  c.resolveEmotion("", content),
+			Language: lang.Detect(content).Code,
+		}
+		if c.segments {
+			reply.Segments = []Segment{{Text: reply.Text, Emotion: reply.Emotion}}
+		}
+		return reply
 	}
 
-	emotion := normalizeEmotion(aiPayload.Emotion, c.emotions)
-	if emotion == "" {
-		emotion = fallbackEmotion(c.emotions)
+	text := strings.TrimSpace(aiPayload.Reply)
+	if c.segments {
+		return c.segmentedReply([]Segment{{Text: text, Emotion: aiPayload.Emotion}})
 	}
-
 	return Reply{
-		Text:    strings.TrimSpace(aiPayload.Reply),
-		Emotion: emotion,
-	}, nil
+		Text:       text,
+		Emotion:    c.resolveEmotion(aiPayload.Emotion, text),
+		Language:   lang.Detect(text).Code,
+		Structured: true,
+	}
 }
 
-func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, onChunk func(string) error, onEmotion func(string) error) (Reply, error) {
-	messages := make([]chatMessage, 0, len(history)+1)
+// CompleteJSON sends a single system and user message without the persona
+// prompt or reply schema, asking for a JSON object, and returns the raw
+// answer. It is meant for auxiliary tasks such as grading replies.
+func (c *Client) CompleteJSON(ctx context.Context, system, prompt string) (string, error) {
+	return c.complete(ctx, system, prompt, responseFormat{Type: "json_object"})
+}
 
-	emotionList := strings.Join(c.emotions, ", ")
-	formatInstruction := fmt.Sprintf("Respond ONLY with valid JSON and no extra text. The JSON must have keys 'emotion' and 'reply' in that order. 'emotion' must be one of: %s.", emotionList)
-	systemPrompt := strings.TrimSpace(c.systemPrompt)
-	if prompt := c.loadPromptFromFile(); prompt != "" {
-		systemPrompt = prompt
+// CompleteSchema is CompleteJSON with a strict JSON schema for the answer.
+// Providers without structured output get plain JSON mode instead.
+func (c *Client) CompleteSchema(ctx context.Context, system, prompt, name string, schema map[string]any) (string, error) {
+	format := responseFormat{
+		Type: "json_schema",
+		JsonSchema: &jsonSchema{
+			Name:   name,
+			Schema: schema,
+			Strict: true,
+		},
 	}
-	messages = append(messages, chatMessage{
-		Role:    "system",
-		Content: strings.TrimSpace(systemPrompt + "\n\n" + formatInstruction),
-	})
+	content, err := c.complete(ctx, system, prompt, format)
+	if apiErr := (*apiError)(nil); errors.As(err, &apiErr) && shouldFallbackToJSONMode(apiErr.status, apiErr.body) {
+		return c.CompleteJSON(ctx, system, prompt)
+	}
+	return content, err
+}
 
-	for _, msg := range history {
-		role := msg.Role
-		switch role {
-		case "user", "assistant":
-			messages = append(messages, chatMessage{Role: role, Content: msg.Content})
-		}
+func (c *Client) complete(ctx context.Context, system, prompt string, format responseFormat) (string, error) {
+	reqBody := chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+		ResponseFormat: format,
+	}
+	parsed, err := c.doChatRequest(ctx, reqBody)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.Choices) == 0 {
+		return "", errors.New("openai api returned no choices")
 	}
+	return strings.TrimSpace(parsed.Choices[0].Message.Content), nil
+}
+
+func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, opts ReplyOptions, onChunk func(string) error, onEmotion func(string) error) (Reply, error) {
+	messages := c.buildMessages(history, opts)
 
 	reqBody := chatRequest{
 		Model:          c.model,
@@ -208,16 +430,57 @@ func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, onCh
 		ResponseFormat: c.buildStructuredFormat(),
 	}
 
-	body, err := c.doChatStreamRequestWithFallback(ctx, reqBody)
+	parser := newJSONStreamParser(onChunk, onEmotion)
+	raw, refusal, reqBody, err := c.streamContent(ctx, reqBody, parser.Feed)
 	if err != nil {
 		return Reply{}, err
 	}
+
+	content := strings.TrimSpace(parser.Reply())
+	if content == "" {
+		rawContent := strings.TrimSpace(raw)
+		if rawContent != "" {
+			if parsed, ok := parseAIJSON(rawContent); ok && parsed.Reply != "" {
+				content = strings.TrimSpace(parsed.Reply)
+				if parser.Emotion() == "" {
+					parser.SetEmotion(parsed.Emotion)
+				}
+			}
+		}
+	}
+	if content == "" {
+		if strings.TrimSpace(refusal) != "" {
+			return Reply{}, ErrRefused
+		}
+		return Reply{}, ErrEmptyReply
+	}
+
+	// The text has already been sent, so a reply in the wrong language can
+	// only be flagged, not retried.
+	text := strings.TrimSpace(content)
+	language := lang.Detect(text).Code
+	return c.withPrompt(Reply{
+		Text:             text,
+		Emotion:          c.resolveEmotion(parser.Emotion(), text),
+		Language:         language,
+		LanguageMismatch: languageMismatch(opts.Language, language),
+		Structured:       true,
+	}, reqBody, history), nil
+}
+
+// streamContent sends a streaming request and passes every content delta to
+// feed. It returns the complete content, any refusal text and the request as
+// finally sent.
+func (c *Client) streamContent(ctx context.Context, reqBody chatRequest, feed func(string) error) (string, string, chatRequest, error) {
+	body, reqBody, err := c.doChatStreamRequestWithFallback(ctx, reqBody)
+	if err != nil {
+		return "", "", reqBody, err
+	}
 	defer body.Close()
 
 	reader := bufio.NewReader(body)
 	var refusalBuilder strings.Builder
 	var rawBuilder strings.Builder
-	parser := newJSONStreamParser(onChunk, onEmotion)
 
 	for {
 		line, err := reader.ReadString('\n')
@@ -225,7 +488,7 @@ func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, onCh
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return Reply{}, err
+			return "", "", reqBody, err
 		}
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -248,8 +511,8 @@ func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, onCh
 		for _, choice := range chunk.Choices {
 			if choice.Delta.Content != "" {
 				rawBuilder.WriteString(choice.Delta.Content)
-				if err := parser.Feed(choice.Delta.Content); err != nil {
-					return Reply{}, err
+				if err := feed(choice.Delta.Content); err != nil {
+					return "", "", reqBody, err
 				}
 			}
 			if choice.Delta.Refusal != "" {
@@ -257,35 +520,104 @@ func (c *Client) StreamReply(ctx context.Context, history []db.ChatMessage, onCh
 			}
 		}
 	}
+	return rawBuilder.String(), refusalBuilder.String(), reqBody, nil
+}
 
-	content := strings.TrimSpace(parser.Reply())
-	if content == "" {
-		rawContent := strings.TrimSpace(rawBuilder.String())
-		if rawContent != "" {
-			if parsed, ok := parseAIJSON(rawContent); ok && parsed.Reply != "" {
-				content = strings.TrimSpace(parsed.Reply)
-				if parser.Emotion() == "" {
-					parser.SetEmotion(parsed.Emotion)
-				}
-			}
-		}
+// withPrompt records the model and prompt version of reply, and attaches
+// the request that produced it when capture is on.
+func (c *Client) withPrompt(reply Reply, req chatRequest, history []db.ChatMessage) Reply {
+	reply.Model = req.Model
+	reply.PromptVersion = c.promptVersion()
+	if !c.capture {
+		return reply
 	}
-	if content == "" {
-		if strings.TrimSpace(refusalBuilder.String()) != "" {
-			return Reply{}, errors.New("openai api refused to answer")
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return reply
+	}
+
+	systemPrompt := ""
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		systemPrompt = req.Messages[0].Content
+	}
+	hash := sha256.Sum256([]byte(systemPrompt))
+	ids := make([]pgtype.UUID, 0, len(history))
+	for _, msg := range history {
+		ids = append(ids, msg.Uuid)
+	}
+
+	reply.Prompt = &Prompt{
+		Model:            req.Model,
+		Temperature:      req.Temperature,
+		ResponseFormat:   req.ResponseFormat.Type,
+		SystemPrompt:     systemPrompt,
+		SystemPromptHash: hex.EncodeToString(hash[:]),
+		HistoryIDs:       ids,
+		Request:          payload,
+	}
+	return reply
+}
+
+func (c *Client) buildMessages(history []db.ChatMessage, opts ReplyOptions) []chatMessage {
+	messages := make([]chatMessage, 0, len(history)+1)
+
+	definitions := c.emotions.Definitions()
+	emotionList := strings.Join(c.emotions.Names(), ", ")
+	formatInstruction := fmt.Sprintf("Respond ONLY with valid JSON and no extra text. The JSON must have keys 'emotion' and 'reply' in that order. 'emotion' must be one of: %s.", emotionList)
+	replyKey := "reply"
+	if c.segments {
+		formatInstruction = c.segmentsInstruction(emotionList)
+		replyKey = "text"
+	}
+	if guidance := emotion.Guidance(definitions); guidance != "" {
+		formatInstruction += "\nPick the emotion that fits the reply best. When several fit, prefer the one with the higher weight (default 1):\n" + guidance
+	}
+	systemPrompt := strings.TrimSpace(c.systemPrompt)
+	if prompt := c.loadPromptFromFile(); prompt != "" {
+		systemPrompt = prompt
+	}
+	if opts.Language != "" {
+		formatInstruction += fmt.Sprintf(" Write '%s' in %s, even if the visitor writes in another language.", replyKey, lang.Name(opts.Language))
+	}
+	messages = append(messages, chatMessage{
+		Role:    "system",
+		Content: strings.TrimSpace(systemPrompt + "\n\n" + formatInstruction),
+	})
+
+	for _, msg := range history {
+		role := msg.Role
+		switch role {
+		case "user":
+			messages = append(messages, c.userMessage(msg.Content, opts.Attachments[msg.Uuid]))
+		case "assistant":
+			messages = append(messages, chatMessage{Role: role, Content: msg.Content})
 		}
-		return Reply{}, errors.New("openai api returned empty content")
 	}
+	return messages
+}
 
-	emotion := normalizeEmotion(parser.Emotion(), c.emotions)
-	if emotion == "" {
-		emotion = fallbackEmotion(c.emotions)
+func (c *Client) userMessage(content string, images []Attachment) chatMessage {
+	if len(images) == 0 {
+		return chatMessage{Role: "user", Content: content}
+	}
+	if !c.vision {
+		note := fmt.Sprintf("[The visitor attached %d image(s) that you cannot see.]", len(images))
+		return chatMessage{Role: "user", Content: strings.TrimSpace(content + "\n\n" + note)}
 	}
 
-	return Reply{
-		Text:    strings.TrimSpace(content),
-		Emotion: emotion,
-	}, nil
+	parts := make([]contentPart, 0, len(images)+1)
+	if strings.TrimSpace(content) != "" {
+		parts = append(parts, contentPart{Type: "text", Text: content})
+	}
+	for _, img := range images {
+		parts = append(parts, contentPart{
+			Type: "image_url",
+			ImageURL: &imageURL{
+				URL: "data:" + img.ContentType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+			},
+		})
+	}
+	return chatMessage{Role: "user", Content: content, Parts: parts}
 }
 
 type apiError struct {
@@ -297,16 +629,24 @@ func (e *apiError) Error() string {
 	return fmt.Sprintf("openai api error: status=%d body=%s", e.status, e.body)
 }
 
-func (c *Client) doChatRequest(ctx context.Context, reqBody chatRequest) (chatResponse, error) {
-	if c.apiKey == "" {
-		return chatResponse{}, errors.New("missing OPENAI_API_KEY")
+// StatusCode returns the HTTP status of a failed provider request, or 0 when
+// err is not one.
+func StatusCode(err error) int {
+	if apiErr := (*apiError)(nil); errors.As(err, &apiErr) {
+		return apiErr.status
 	}
+	return 0
+}
 
+func (c *Client) doChatRequest(ctx context.Context, reqBody chatRequest) (chatResponse, error) {
 	payload, err := json.Marshal(reqBody)
 	if err != nil {
 		return chatResponse{}, err
 	}
+	return c.doChatPayload(ctx, payload)
+}
 
+func (c *Client) doChatPayload(ctx context.Context, payload []byte) (chatResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
 	if err != nil {
 		return chatResponse{}, err
@@ -333,7 +673,7 @@ func (c *Client) doChatRequest(ctx context.Context, reqBody chatRequest) (chatRe
 	return parsed, nil
 }
 
-func (c *Client) doChatStreamRequestWithFallback(ctx context.Context, reqBody chatRequest) (io.ReadCloser, error) {
+func (c *Client) doChatStreamRequestWithFallback(ctx context.Context, reqBody chatRequest) (io.ReadCloser, chatRequest, error) {
 	body, err := c.doChatStreamRequest(ctx, reqBody)
 	if err != nil {
 		if apiErr := (*apiError)(nil); errors.As(err, &apiErr) && shouldRetryWithoutTemperature(apiErr.status, apiErr.body) {
@@ -353,17 +693,13 @@ func (c *Client) doChatStreamRequestWithFallback(ctx context.Context, reqBody ch
 			}
 		}
 		if err != nil {
-			return nil, err
+			return nil, reqBody, err
 		}
 	}
-	return body, nil
+	return body, reqBody, nil
 }
 
 func (c *Client) doChatStreamRequest(ctx context.Context, reqBody chatRequest) (io.ReadCloser, error) {
-	if c.apiKey == "" {
-		return nil, errors.New("missing OPENAI_API_KEY")
-	}
-
 	payload, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
@@ -377,7 +713,7 @@ func (c *Client) doChatStreamRequest(ctx context.Context, reqBody chatRequest) (
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.streamClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -403,6 +739,9 @@ func (c *Client) buildStructuredFormat() responseFormat {
 		},
 		"required": []string{"reply", "emotion"},
 	}
+	if c.segments {
+		schema = c.buildSegmentsSchema()
+	}
 
 	return responseFormat{
 		Type: "json_schema",
@@ -419,8 +758,12 @@ func (c *Client) buildEmotionSchema() map[string]any {
 	prop := map[string]any{
 		"type": "string",
 	}
-	if len(c.emotions) > 0 {
-		prop["enum"] = c.emotions
+	definitions := c.emotions.Definitions()
+	if len(definitions) > 0 {
+		prop["enum"] = c.emotions.Names()
+	}
+	if guidance := emotion.Guidance(definitions); guidance != "" {
+		prop["description"] = "The emotion shown on the avatar while the reply is displayed.\n" + guidance
 	}
 	return prop
 }
@@ -650,6 +993,12 @@ func parseAIJSON(content string) (aiJSON, bool) {
 	return parsed, true
 }
 
+// languageMismatch reports whether a reply was confidently detected in a
+// language other than the requested one.
+func languageMismatch(want, got string) bool {
+	return want != "" && got != "" && lang.Normalize(want) != got
+}
+
 func normalizeEmotion(emotion string, allowed []string) string {
 	emotion = strings.ToLower(strings.TrimSpace(emotion))
 	for _, e := range allowed {
@@ -660,6 +1009,33 @@ func normalizeEmotion(emotion string, allowed []string) string {
 	return ""
 }
 
+// resolveEmotion returns the model's emotion if it is allowed, and otherwise
+// asks the lexicon classifier. With override enabled, a valid emotion that the
+// reply text clearly contradicts is replaced by the classifier's guess too.
+func (c *Client) resolveEmotion(raw, text string) string {
+	allowed := c.emotions.Names()
+	classifier := emotion.NewClassifier(c.lexicon, allowed)
+	resolved := normalizeEmotion(raw, allowed)
+	if resolved == "" {
+		if guess := classifier.Classify(text).Emotion; normalizeEmotion(guess, allowed) != "" {
+			return guess
+		}
+		return fallbackEmotion(allowed)
+	}
+	if c.override {
+		if guess, mismatch := classifier.Contradicts(resolved, text); mismatch {
+			return guess.Emotion
+		}
+	}
+	return resolved
+}
+
+// Emotions returns the emotion set offered to the model. Replacing its
+// definitions takes effect from the next request.
+func (c *Client) Emotions() *emotion.Set {
+	return c.emotions
+}
+
 func fallbackEmotion(allowed []string) string {
 	for _, e := range allowed {
 		if strings.TrimSpace(e) != "" {
@@ -669,6 +1045,17 @@ func fallbackEmotion(allowed []string) string {
 	return "neutral"
 }
 
+// promptVersion is a short hash of the persona prompt, without the
+// per-request format and language instructions.
+func (c *Client) promptVersion() string {
+	systemPrompt := strings.TrimSpace(c.systemPrompt)
+	if prompt := c.loadPromptFromFile(); prompt != "" {
+		systemPrompt = prompt
+	}
+	hash := sha256.Sum256([]byte(systemPrompt))
+	return hex.EncodeToString(hash[:6])
+}
+
 func (c *Client) loadPromptFromFile() string {
 	path := strings.TrimSpace(c.promptPath)
 	if path == "" {
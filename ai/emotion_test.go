@@ -0,0 +1,38 @@
+package ai
+
+import "testing"
+
+func TestResolveEmotion(t *testing.T) {
+	tests := []struct {
+		name     string
+		override bool
+		raw      string
+		text     string
+		want     string
+	}{
+		{name: "valid", raw: "happy", text: "Nice to meet you.", want: "happy"},
+		{name: "case and space", raw: " Sad ", text: "Oh no.", want: "sad"},
+		{name: "missing", raw: "", text: "Sorry, that is sad.", want: "sad"},
+		{name: "invalid", raw: "ecstatic", text: "Haha, so funny.", want: "amused"},
+		{name: "invalid without cues", raw: "ecstatic", text: "The meeting is at noon.", want: "neutral"},
+		{name: "contradicted without override", raw: "happy", text: "Sorry, that's sad. I miss her.", want: "happy"},
+		{name: "contradicted with override", override: true, raw: "happy", text: "Sorry, that's sad. I miss her.", want: "sad"},
+		{name: "weak evidence with override", override: true, raw: "happy", text: "Sorry to hear that.", want: "happy"},
+		{name: "same polarity with override", override: true, raw: "happy", text: "Haha, so funny!", want: "happy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"OPENAI_API_KEY": "test-key"}
+			if tt.override {
+				env["AI_EMOTION_OVERRIDE"] = "true"
+			}
+			client, err := NewClient(testConfig(t, env))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			if got := client.resolveEmotion(tt.raw, tt.text); got != tt.want {
+				t.Fatalf("resolveEmotion(%q, %q) = %s, want %s", tt.raw, tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models/db"
+)
+
+// Segment is one part of a multi-segment reply, shown as its own bubble with
+// its own avatar expression.
+type Segment struct {
+	Text    string `json:"text"`
+	Emotion string `json:"emotion"`
+}
+
+type aiSegment struct {
+	Emotion string `json:"emotion"`
+	Text    string `json:"text"`
+}
+
+// SegmentsEnabled reports whether replies are requested as a list of segments.
+func (c *Client) SegmentsEnabled() bool {
+	return c.segments
+}
+
+// StreamSegments streams a multi-segment reply. onStart is called when the
+// text of a segment begins, with the model's emotion if it is already known and
+// allowed, onChunk with pieces of the segment text, and onEnd with the complete
+// segment and its final emotion. Segments without text are skipped, so the
+// indexes match the returned Reply.Segments.
+func (c *Client) StreamSegments(ctx context.Context, history []db.ChatMessage, opts ReplyOptions, onStart func(int, string) error, onChunk func(string) error, onEnd func(int, Segment) error) (Reply, error) {
+	messages := c.buildMessages(history, opts)
+
+	reqBody := chatRequest{
+		Model:          c.model,
+		Messages:       messages,
+		Temperature:    c.temperature,
+		Stream:         true,
+		ResponseFormat: c.buildStructuredFormat(),
+	}
+
+	parser := newSegmentStreamParser(
+		func(index int, emotion string) error {
+			if onStart == nil {
+				return nil
+			}
+			return onStart(index, normalizeEmotion(emotion, c.emotions.Names()))
+		},
+		onChunk,
+		func(index int, segment Segment) error {
+			if onEnd == nil {
+				return nil
+			}
+			segment.Text = strings.TrimSpace(segment.Text)
+			segment.Emotion = c.resolveEmotion(segment.Emotion, segment.Text)
+			return onEnd(index, segment)
+		},
+	)
+
+	raw, refusal, reqBody, err := c.streamContent(ctx, reqBody, parser.Feed)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var reply Reply
+	if segments := parser.Segments(); hasText(segments) {
+		reply = c.segmentedReply(segments)
+	} else if content := strings.TrimSpace(raw); content != "" {
+		reply = c.parseContent(content)
+	} else if strings.TrimSpace(refusal) != "" {
+		return Reply{}, ErrRefused
+	} else {
+		return Reply{}, ErrEmptyReply
+	}
+	// Like StreamReply, a reply in the wrong language is flagged, not retried.
+	reply.LanguageMismatch = languageMismatch(opts.Language, reply.Language)
+	return c.withPrompt(reply, reqBody, history), nil
+}
+
+// segmentedReply resolves the emotion of every segment and joins their texts.
+// The reply's emotion is the one of the first segment.
+func (c *Client) segmentedReply(segments []Segment) Reply {
+	resolved := make([]Segment, 0, len(segments))
+	texts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		resolved = append(resolved, Segment{Text: text, Emotion: c.resolveEmotion(segment.Emotion, text)})
+		texts = append(texts, text)
+	}
+	if len(resolved) == 0 {
+		return Reply{}
+	}
+	text := strings.Join(texts, "\n\n")
+	return Reply{
+		Text:       text,
+		Emotion:    resolved[0].Emotion,
+		Language:   lang.Detect(text).Code,
+		Structured: true,
+		Segments:   resolved,
+	}
+}
+
+func (c *Client) segmentsInstruction(emotionList string) string {
+	return fmt.Sprintf("Respond ONLY with valid JSON and no extra text. The JSON must have a single key 'segments': a list of 1 to %d objects with keys 'emotion' and 'text' in that order. Each segment is shown as a separate chat bubble with its own facial expression, so split the reply where the mood changes or a new bubble reads naturally; short replies need only one segment. 'emotion' must be one of: %s.", c.maxSegments, emotionList)
+}
+
+func (c *Client) buildSegmentsSchema() map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"segments": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type":                 "object",
+					"additionalProperties": false,
+					"properties": map[string]any{
+						"emotion": c.buildEmotionSchema(),
+						"text": map[string]any{
+							"type": "string",
+						},
+					},
+					"required": []string{"emotion", "text"},
+				},
+			},
+		},
+		"required": []string{"segments"},
+	}
+}
+
+func hasText(segments []Segment) bool {
+	for _, segment := range segments {
+		if strings.TrimSpace(segment.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentStreamParser incrementally reads {"segments":[{"emotion":..,
+// "text":..},..]} and reports segments as they open, grow and close. A segment
+// opens at the first non-space rune of its text; blank segments are never
+// reported. Anything outside the segments array is ignored.
+type segmentStreamParser struct {
+	onStart func(int, string) error
+	onChunk func(string) error
+	onEnd   func(int, Segment) error
+
+	// stack holds the open containers, '{' or '['; keys the last key seen in
+	// each of them.
+	stack       []rune
+	keys        []string
+	expectKey   bool
+	inString    bool
+	isKey       bool
+	escape      bool
+	unicodeLeft int
+	unicodeBuf  strings.Builder
+	str         strings.Builder
+	text        strings.Builder
+	chunk       strings.Builder
+
+	current  *Segment
+	started  bool
+	segments []Segment
+}
+
+func newSegmentStreamParser(onStart func(int, string) error, onChunk func(string) error, onEnd func(int, Segment) error) *segmentStreamParser {
+	return &segmentStreamParser{onStart: onStart, onChunk: onChunk, onEnd: onEnd}
+}
+
+func (p *segmentStreamParser) Feed(text string) error {
+	for _, r := range text {
+		if p.unicodeLeft > 0 {
+			p.unicodeBuf.WriteRune(r)
+			p.unicodeLeft--
+			if p.unicodeLeft == 0 {
+				decoded, ok := decodeUnicode(p.unicodeBuf.String())
+				p.unicodeBuf.Reset()
+				if ok {
+					if err := p.handleRune(decoded); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		if p.inString {
+			if p.escape {
+				p.escape = false
+				if r == 'u' {
+					p.unicodeLeft = 4
+					continue
+				}
+				if err := p.handleRune(unescape(r)); err != nil {
+					return err
+				}
+				continue
+			}
+			switch r {
+			case '\\':
+				p.escape = true
+			case '"':
+				if err := p.endString(); err != nil {
+					return err
+				}
+			default:
+				if err := p.handleRune(r); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		switch r {
+		case '"':
+			p.inString = true
+			p.isKey = p.top() == '{' && p.expectKey
+			p.str.Reset()
+		case '{':
+			p.push(r)
+			p.expectKey = true
+			if p.inSegmentObject() {
+				p.current = &Segment{}
+				p.text.Reset()
+				p.started = false
+			}
+		case '[':
+			p.push(r)
+		case '}':
+			if p.inSegmentObject() && p.current != nil {
+				if err := p.endSegment(); err != nil {
+					return err
+				}
+			}
+			p.pop()
+		case ']':
+			p.pop()
+		case ':':
+			p.expectKey = false
+		case ',':
+			p.expectKey = p.top() == '{'
+		}
+	}
+	return p.flush()
+}
+
+func (p *segmentStreamParser) handleRune(r rune) error {
+	if p.isKey || !p.inSegmentObject() || p.current == nil {
+		p.str.WriteRune(r)
+		return nil
+	}
+	switch p.keys[len(p.keys)-1] {
+	case "text":
+		if !p.started && unicode.IsSpace(r) {
+			return nil
+		}
+		if err := p.start(); err != nil {
+			return err
+		}
+		p.text.WriteRune(r)
+		p.chunk.WriteRune(r)
+	default:
+		p.str.WriteRune(r)
+	}
+	return nil
+}
+
+func (p *segmentStreamParser) endString() error {
+	p.inString = false
+	if p.isKey {
+		p.keys[len(p.keys)-1] = p.str.String()
+		p.str.Reset()
+		return nil
+	}
+	if p.inSegmentObject() && p.current != nil && p.keys[len(p.keys)-1] == "emotion" {
+		p.current.Emotion = p.str.String()
+	}
+	p.str.Reset()
+	return nil
+}
+
+func (p *segmentStreamParser) start() error {
+	if p.started {
+		return nil
+	}
+	p.started = true
+	if p.onStart != nil {
+		return p.onStart(len(p.segments), p.current.Emotion)
+	}
+	return nil
+}
+
+func (p *segmentStreamParser) endSegment() error {
+	if !p.started {
+		// Blank segments are dropped like in segmentedReply.
+		p.current = nil
+		return nil
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	segment := *p.current
+	segment.Text = p.text.String()
+	index := len(p.segments)
+	p.segments = append(p.segments, segment)
+	p.current = nil
+	if p.onEnd != nil {
+		return p.onEnd(index, segment)
+	}
+	return nil
+}
+
+func (p *segmentStreamParser) flush() error {
+	if p.chunk.Len() == 0 {
+		return nil
+	}
+	chunk := p.chunk.String()
+	p.chunk.Reset()
+	if p.onChunk != nil {
+		return p.onChunk(chunk)
+	}
+	return nil
+}
+
+// inSegmentObject reports whether the parser is directly inside an object of
+// the top-level "segments" array.
+func (p *segmentStreamParser) inSegmentObject() bool {
+	return len(p.stack) == 3 && p.stack[0] == '{' && p.keys[0] == "segments" && p.stack[1] == '[' && p.stack[2] == '{'
+}
+
+func (p *segmentStreamParser) top() rune {
+	if len(p.stack) == 0 {
+		return 0
+	}
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *segmentStreamParser) push(r rune) {
+	p.stack = append(p.stack, r)
+	p.keys = append(p.keys, "")
+}
+
+func (p *segmentStreamParser) pop() {
+	if len(p.stack) == 0 {
+		return
+	}
+	p.stack = p.stack[:len(p.stack)-1]
+	p.keys = p.keys[:len(p.keys)-1]
+	p.expectKey = false
+}
+
+// Segments returns the completed segments and, if the stream stopped inside
+// one, the partial last segment.
+func (p *segmentStreamParser) Segments() []Segment {
+	segments := append([]Segment(nil), p.segments...)
+	if p.current != nil && p.text.Len() > 0 {
+		segments = append(segments, Segment{Text: p.text.String(), Emotion: p.current.Emotion})
+	}
+	return segments
+}
+
+func unescape(r rune) rune {
+	switch r {
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+	return r
+}
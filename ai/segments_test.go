@@ -0,0 +1,256 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// segmentEvents records what a segmentStreamParser reports. Chunks are joined
+// per segment, since how the text is cut depends on how the input was split.
+type segmentEvents struct {
+	starts []string
+	texts  []string
+	ends   []string
+}
+
+func (e *segmentEvents) parser() *segmentStreamParser {
+	return newSegmentStreamParser(
+		func(index int, emotion string) error {
+			e.starts = append(e.starts, fmt.Sprintf("%d:%s", index, emotion))
+			e.texts = append(e.texts, "")
+			return nil
+		},
+		func(chunk string) error {
+			if len(e.texts) == 0 {
+				return fmt.Errorf("chunk %q outside a segment", chunk)
+			}
+			e.texts[len(e.texts)-1] += chunk
+			return nil
+		},
+		func(index int, segment Segment) error {
+			e.ends = append(e.ends, fmt.Sprintf("%d:%s:%s", index, segment.Emotion, segment.Text))
+			return nil
+		},
+	)
+}
+
+// splits returns input cut into two pieces at every rune boundary and into
+// single runes. Deltas from the API are always whole runes.
+func splits(input string) [][]string {
+	var out [][]string
+	for i := range input {
+		out = append(out, []string{input[:i], input[i:]})
+	}
+	runes := make([]string, 0, utf8.RuneCountInString(input))
+	for _, r := range input {
+		runes = append(runes, string(r))
+	}
+	return append(out, runes)
+}
+
+func TestSegmentStreamParserChunkBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		starts   []string
+		texts    []string
+		ends     []string
+		segments []Segment
+	}{
+		{
+			name:     "two segments",
+			input:    `{"segments":[{"emotion":"happy","text":"Hi there!"},{"emotion":"sad","text":"Bye."}]}`,
+			starts:   []string{"0:happy", "1:sad"},
+			texts:    []string{"Hi there!", "Bye."},
+			ends:     []string{"0:happy:Hi there!", "1:sad:Bye."},
+			segments: []Segment{{Text: "Hi there!", Emotion: "happy"}, {Text: "Bye.", Emotion: "sad"}},
+		},
+		{
+			name:     "escapes",
+			input:    `{"segments":[{"emotion":"happy","text":"Say \"hi\"\\\nnext\tline"}]}`,
+			starts:   []string{"0:happy"},
+			texts:    []string{"Say \"hi\"\\\nnext\tline"},
+			ends:     []string{"0:happy:Say \"hi\"\\\nnext\tline"},
+			segments: []Segment{{Text: "Say \"hi\"\\\nnext\tline", Emotion: "happy"}},
+		},
+		{
+			name:     "unicode escapes",
+			input:    `{"segments":[{"emotion":"h\u0061ppy","text":"G\u00fcnayd\u0131n \u00E7ay"}]}`,
+			starts:   []string{"0:happy"},
+			texts:    []string{"Günaydın çay"},
+			ends:     []string{"0:happy:Günaydın çay"},
+			segments: []Segment{{Text: "Günaydın çay", Emotion: "happy"}},
+		},
+		{
+			name:     "raw unicode",
+			input:    `{"segments":[{"emotion":"happy","text":"Merhaba 👋 dünya"}]}`,
+			starts:   []string{"0:happy"},
+			texts:    []string{"Merhaba 👋 dünya"},
+			ends:     []string{"0:happy:Merhaba 👋 dünya"},
+			segments: []Segment{{Text: "Merhaba 👋 dünya", Emotion: "happy"}},
+		},
+		{
+			name:     "whitespace and blank segments",
+			input:    "{ \"segments\" : [ {\"emotion\":\"sad\",\"text\":\"  \"}, { \"emotion\" : \"happy\" , \"text\" : \"\\n Hello\" } ] }",
+			starts:   []string{"0:happy"},
+			texts:    []string{"Hello"},
+			ends:     []string{"0:happy:Hello"},
+			segments: []Segment{{Text: "Hello", Emotion: "happy"}},
+		},
+		{
+			name:     "text before emotion",
+			input:    `{"segments":[{"text":"Hi","emotion":"happy"}]}`,
+			starts:   []string{"0:"},
+			texts:    []string{"Hi"},
+			ends:     []string{"0:happy:Hi"},
+			segments: []Segment{{Text: "Hi", Emotion: "happy"}},
+		},
+		{
+			name:     "braces and keys inside strings",
+			input:    `{"note":"{\"segments\":[]}","segments":[{"emotion":"happy","text":"a } ] { [ \"text\": b"}]}`,
+			starts:   []string{"0:happy"},
+			texts:    []string{`a } ] { [ "text": b`},
+			ends:     []string{`0:happy:a } ] { [ "text": b`},
+			segments: []Segment{{Text: `a } ] { [ "text": b`, Emotion: "happy"}},
+		},
+		{
+			name:     "partial json",
+			input:    `{"segments":[{"emotion":"happy","text":"Done."},{"emotion":"sad","text":"Cut of`,
+			starts:   []string{"0:happy", "1:sad"},
+			texts:    []string{"Done.", "Cut of"},
+			ends:     []string{"0:happy:Done."},
+			segments: []Segment{{Text: "Done.", Emotion: "happy"}, {Text: "Cut of", Emotion: "sad"}},
+		},
+		{
+			name:     "partial json before the text",
+			input:    `{"segments":[{"emotion":"happy","text":"Done."},{"emotion":"sad","te`,
+			starts:   []string{"0:happy"},
+			texts:    []string{"Done."},
+			ends:     []string{"0:happy:Done."},
+			segments: []Segment{{Text: "Done.", Emotion: "happy"}},
+		},
+		{
+			name:  "reply shape",
+			input: `{"emotion":"happy","reply":"Hi there!"}`,
+		},
+		{
+			name:  "plain text",
+			input: "Hi there!",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pieces := range splits(tt.input) {
+				var events segmentEvents
+				parser := events.parser()
+				for _, piece := range pieces {
+					if err := parser.Feed(piece); err != nil {
+						t.Fatalf("Feed(%q): %v", pieces, err)
+					}
+				}
+				if !reflect.DeepEqual(events.starts, tt.starts) {
+					t.Fatalf("%q: starts = %q, want %q", pieces, events.starts, tt.starts)
+				}
+				if !reflect.DeepEqual(events.texts, tt.texts) {
+					t.Fatalf("%q: texts = %q, want %q", pieces, events.texts, tt.texts)
+				}
+				if !reflect.DeepEqual(events.ends, tt.ends) {
+					t.Fatalf("%q: ends = %q, want %q", pieces, events.ends, tt.ends)
+				}
+				if segments := parser.Segments(); !reflect.DeepEqual(segments, tt.segments) {
+					t.Fatalf("%q: Segments() = %+v, want %+v", pieces, segments, tt.segments)
+				}
+			}
+		})
+	}
+}
+
+// fakeStream answers every chat completion with content, streamed in pieces
+// of size bytes.
+func fakeStream(t *testing.T, content string, size int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < len(content); i += size {
+			piece := content[i:min(i+size, len(content))]
+			data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": piece}}}})
+			_, _ = w.Write([]byte("data: " + string(data) + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStreamSegmentsShapeFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		streamed int
+		segments []Segment
+	}{
+		{
+			name:     "segments",
+			content:  `{"segments":[{"emotion":"happy","text":" Hi! "},{"emotion":"sad","text":""},{"emotion":"sad","text":"Bye."}]}`,
+			streamed: 2,
+			segments: []Segment{{Text: "Hi!", Emotion: "happy"}, {Text: "Bye.", Emotion: "sad"}},
+		},
+		{
+			name:     "reply shape",
+			content:  `{"emotion":"sad","reply":"Oh no."}`,
+			segments: []Segment{{Text: "Oh no.", Emotion: "sad"}},
+		},
+		{
+			name:     "segments without text",
+			content:  `{"segments":[{"emotion":"sad","text":" "}],"emotion":"happy","reply":"Hello!"}`,
+			segments: []Segment{{Text: "Hello!", Emotion: "happy"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakeStream(t, tt.content, 5)
+			client, err := NewClient(testConfig(t, map[string]string{
+				"OPENAI_API_KEY":      "test-key",
+				"OPENAI_BASE_URL":     server.URL + "/v1",
+				"AI_SEGMENTS_ENABLED": "true",
+			}))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			var ended []Segment
+			reply, err := client.StreamSegments(context.Background(), testHistory(), ReplyOptions{}, nil, nil, func(index int, segment Segment) error {
+				if index != len(ended) {
+					t.Errorf("segment %d ended after %d segments", index, len(ended))
+				}
+				ended = append(ended, segment)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamSegments: %v", err)
+			}
+			if len(ended) != tt.streamed {
+				t.Fatalf("%d segments streamed, want %d", len(ended), tt.streamed)
+			}
+			if !reflect.DeepEqual(reply.Segments, tt.segments) {
+				t.Fatalf("Segments = %+v, want %+v", reply.Segments, tt.segments)
+			}
+			if len(ended) > 0 && !reflect.DeepEqual(ended, reply.Segments[:len(ended)]) {
+				t.Fatalf("streamed %+v, reply has %+v", ended, reply.Segments)
+			}
+			texts := make([]string, len(tt.segments))
+			for i, segment := range tt.segments {
+				texts[i] = segment.Text
+			}
+			if want := strings.Join(texts, "\n\n"); reply.Text != want {
+				t.Fatalf("Text = %q, want %q", reply.Text, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcriptVersion is written to every recorded entry. Entries without a
+// version were recorded when Hash covered the full URL path; their hash is
+// derived again from the recorded request when a transcript is read.
+const transcriptVersion = 2
+
+// TranscriptEntry is one upstream request/response pair as stored in a
+// transcript file, one JSON object per line.
+type TranscriptEntry struct {
+	Version         int                 `json:"version,omitempty"`
+	Time            time.Time           `json:"time"`
+	Hash            string              `json:"hash"`
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	Request         json.RawMessage     `json:"request"`
+	Status          int                 `json:"status,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	Response        string              `json:"response,omitempty"`
+	Chunks          []TranscriptChunk   `json:"chunks,omitempty"`
+	FirstByteMs     int64               `json:"first_byte_ms"`
+	DurationMs      int64               `json:"duration_ms"`
+	Error           string              `json:"error,omitempty"`
+}
+
+// TranscriptChunk is a piece of a streamed response body with the time it
+// arrived, relative to the start of the request.
+type TranscriptChunk struct {
+	OffsetMs int64  `json:"offset_ms"`
+	Data     string `json:"data"`
+}
+
+// RequestHash identifies a request for replay: the method, the endpoint (last
+// URL path element, so transcripts work against any base URL) and the JSON
+// body with its keys sorted, so formatting differences do not matter.
+func RequestHash(method, urlPath string, body []byte) string {
+	canonical := body
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if encoded, err := json.Marshal(decoded); err == nil {
+			canonical = encoded
+		}
+	}
+	sum := sha256.New()
+	sum.Write([]byte(strings.ToUpper(method) + " " + path.Base(urlPath) + "\n"))
+	sum.Write(canonical)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// Recorder is an http.RoundTripper that passes requests through and appends
+// every exchange to a JSONL transcript. Authorization headers are redacted.
+type Recorder struct {
+	next http.RoundTripper
+	path string
+	mu   sync.Mutex
+}
+
+func NewRecorder(next http.RoundTripper, path string) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next, path: path}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	entry := TranscriptEntry{
+		Version:        transcriptVersion,
+		Time:           start.UTC(),
+		Hash:           RequestHash(req.Method, req.URL.Path, body),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: redactHeaders(req.Header),
+		Request:        rawJSON(body),
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.DurationMs = time.Since(start).Milliseconds()
+		r.write(entry)
+		return nil, err
+	}
+
+	entry.Status = resp.StatusCode
+	entry.ResponseHeaders = resp.Header.Clone()
+	resp.Body = &recordingBody{
+		body:     resp.Body,
+		recorder: r,
+		entry:    entry,
+		start:    start,
+		stream:   isStreamRequest(body),
+	}
+	return resp, nil
+}
+
+func (r *Recorder) write(entry TranscriptEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if dir := filepath.Dir(r.path); dir != "" {
+		_ = os.MkdirAll(dir, 0o755)
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(line, '\n'))
+}
+
+// recordingBody captures the response body as the client reads it and writes
+// the transcript entry once the body is exhausted or closed.
+type recordingBody struct {
+	body     io.ReadCloser
+	recorder *Recorder
+	entry    TranscriptEntry
+	start    time.Time
+	stream   bool
+	buf      bytes.Buffer
+	once     sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		offset := time.Since(b.start).Milliseconds()
+		if b.entry.FirstByteMs == 0 {
+			b.entry.FirstByteMs = offset
+		}
+		if b.stream {
+			b.entry.Chunks = append(b.entry.Chunks, TranscriptChunk{OffsetMs: offset, Data: string(p[:n])})
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.entry.Error = err.Error()
+	}
+	if err != nil {
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.flush()
+	return b.body.Close()
+}
+
+func (b *recordingBody) flush() {
+	b.once.Do(func() {
+		b.entry.Response = b.buf.String()
+		b.entry.DurationMs = time.Since(b.start).Milliseconds()
+		b.recorder.write(b.entry)
+	})
+}
+
+// Replayer is an http.RoundTripper that answers requests from a transcript
+// instead of the network. Requests are matched by RequestHash; when the same
+// request was recorded several times the recordings are served in turn.
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]TranscriptEntry
+	served  map[string]int
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTranscript(f)
+}
+
+// ReadTranscript builds a Replayer from JSONL transcript data. Failed
+// exchanges are skipped.
+func ReadTranscript(r io.Reader) (*Replayer, error) {
+	replayer := &Replayer{
+		entries: map[string][]TranscriptEntry{},
+		served:  map[string]int{},
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", line, err)
+		}
+		if entry.Error != "" || entry.Status == 0 {
+			continue
+		}
+		if entry.Version < transcriptVersion {
+			entry.Hash = legacyEntryHash(entry)
+		}
+		replayer.entries[entry.Hash] = append(replayer.entries[entry.Hash], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return replayer, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	hash := RequestHash(req.Method, req.URL.Path, body)
+
+	r.mu.Lock()
+	recorded := r.entries[hash]
+	if len(recorded) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response for request %s", hash)
+	}
+	entry := recorded[r.served[hash]%len(recorded)]
+	r.served[hash]++
+	r.mu.Unlock()
+
+	payload := entry.Response
+	if len(entry.Chunks) > 0 {
+		var joined strings.Builder
+		for _, chunk := range entry.Chunks {
+			joined.WriteString(chunk.Data)
+		}
+		payload = joined.String()
+	}
+
+	header := http.Header{}
+	for key, values := range entry.ResponseHeaders {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(payload)),
+		ContentLength: int64(len(payload)),
+		Request:       req,
+	}, nil
+}
+
+// legacyEntryHash is the current RequestHash of an entry recorded before
+// transcripts were versioned. Bodies that were not JSON were recorded as a
+// JSON string.
+func legacyEntryHash(entry TranscriptEntry) string {
+	urlPath := entry.URL
+	if u, err := url.Parse(entry.URL); err == nil {
+		urlPath = u.Path
+	}
+	body := []byte(entry.Request)
+	var text string
+	if err := json.Unmarshal(entry.Request, &text); err == nil {
+		body = []byte(text)
+	}
+	return RequestHash(entry.Method, urlPath, body)
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func redactHeaders(header http.Header) map[string][]string {
+	redacted := header.Clone()
+	for key := range redacted {
+		switch http.CanonicalHeaderKey(key) {
+		case "Authorization", "Api-Key", "X-Api-Key":
+			redacted[key] = []string{"[REDACTED]"}
+		}
+	}
+	return redacted
+}
+
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	encoded, _ := json.Marshal(string(body))
+	return encoded
+}
+
+func isStreamRequest(body []byte) bool {
+	var probe struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(body, &probe) == nil && probe.Stream
+}
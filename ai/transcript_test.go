@@ -0,0 +1,181 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sethvargo/go-envconfig"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/models/db"
+)
+
+const fakeReplyContent = `{"emotion":"happy","reply":"Hi, I'm Ugur. Nice to meet you!"}`
+
+// testConfig loads the defaults with env applied on top and a fixed prompt, so
+// requests do not depend on files outside the package.
+func testConfig(t *testing.T, env map[string]string) *config.Config {
+	t.Helper()
+	cfg := &config.Config{}
+	if err := envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target:   cfg,
+		Lookuper: envconfig.MapLookuper(env),
+	}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.AISystemPromptPath = ""
+	cfg.AISystemPrompt = "You are Ugur."
+	return cfg
+}
+
+// fakeOpenAI answers chat completions with fakeReplyContent, streamed in small
+// chunks when the request asks for it.
+func fakeOpenAI(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": fakeReplyContent}}},
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < len(fakeReplyContent); i += 8 {
+			piece := fakeReplyContent[i:min(i+8, len(fakeReplyContent))]
+			data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": piece}}}})
+			_, _ = w.Write([]byte("data: " + string(data) + "\n\n"))
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testHistory() []db.ChatMessage {
+	return []db.ChatMessage{{Role: "user", Content: "Hi, who are you?"}}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	server := fakeOpenAI(t)
+	transcript := filepath.Join(t.TempDir(), "transcript.jsonl")
+
+	recording, err := NewClient(testConfig(t, map[string]string{
+		"OPENAI_API_KEY":  "test-key",
+		"OPENAI_BASE_URL": server.URL + "/v1",
+		"AI_RECORD_PATH":  transcript,
+	}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	recorded, err := recording.GenerateReply(ctx, testHistory(), ReplyOptions{})
+	if err != nil {
+		t.Fatalf("GenerateReply: %v", err)
+	}
+	var recordedChunks strings.Builder
+	recordedStream, err := recording.StreamReply(ctx, testHistory(), ReplyOptions{}, func(chunk string) error {
+		recordedChunks.WriteString(chunk)
+		return nil
+	}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamReply: %v", err)
+	}
+
+	data, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	if strings.Contains(string(data), "test-key") {
+		t.Fatal("transcript contains the API key")
+	}
+	server.Close()
+
+	// The replay needs neither a key nor a reachable server.
+	replaying, err := NewClient(testConfig(t, map[string]string{
+		"AI_PROVIDER":     "replay",
+		"AI_REPLAY_PATH":  transcript,
+		"OPENAI_BASE_URL": "http://127.0.0.1:1/other/v1",
+	}))
+	if err != nil {
+		t.Fatalf("NewClient replay: %v", err)
+	}
+	replayed, err := replaying.GenerateReply(ctx, testHistory(), ReplyOptions{})
+	if err != nil {
+		t.Fatalf("replayed GenerateReply: %v", err)
+	}
+	if replayed.Text != recorded.Text || replayed.Emotion != recorded.Emotion {
+		t.Fatalf("replayed %q/%q, recorded %q/%q", replayed.Text, replayed.Emotion, recorded.Text, recorded.Emotion)
+	}
+	var replayedChunks strings.Builder
+	replayedStream, err := replaying.StreamReply(ctx, testHistory(), ReplyOptions{}, func(chunk string) error {
+		replayedChunks.WriteString(chunk)
+		return nil
+	}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("replayed StreamReply: %v", err)
+	}
+	if replayedStream.Text != recordedStream.Text || replayedChunks.String() != recordedChunks.String() {
+		t.Fatalf("replayed stream %q (%q), recorded %q (%q)", replayedStream.Text, replayedChunks.String(), recordedStream.Text, recordedChunks.String())
+	}
+
+	if _, err := replaying.GenerateReply(ctx, []db.ChatMessage{{Role: "user", Content: "Something else"}}, ReplyOptions{}); err == nil {
+		t.Fatal("unrecorded request was answered")
+	}
+}
+
+// TestReplayFixture replays transcripts checked in under testdata, the way
+// regression tests pin model answers. hello_unversioned.jsonl was recorded
+// before transcripts had a version, when the hash covered the full URL path.
+func TestReplayFixture(t *testing.T) {
+	for _, path := range []string{"testdata/hello.jsonl", "testdata/hello_unversioned.jsonl"} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			client, err := NewClient(testConfig(t, map[string]string{
+				"AI_PROVIDER":    "replay",
+				"AI_REPLAY_PATH": path,
+			}))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			reply, err := client.GenerateReply(context.Background(), testHistory(), ReplyOptions{})
+			if err != nil {
+				t.Fatalf("GenerateReply: %v", err)
+			}
+			if reply.Text != "Hi, I'm Ugur. Nice to meet you!" || reply.Emotion != "happy" || !reply.Structured {
+				t.Fatalf("reply = %+v", reply)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderRequiresKey(t *testing.T) {
+	if _, err := NewClient(testConfig(t, nil)); err == nil || !strings.Contains(err.Error(), "OPENAI_API_KEY") {
+		t.Fatalf("NewClient without key: err = %v", err)
+	}
+}
+
+func TestRequestHashIgnoresFormatting(t *testing.T) {
+	a := RequestHash("POST", "/v1/chat/completions", []byte(`{"model":"m","stream":false}`))
+	b := RequestHash("post", "/v1/chat/completions", []byte("{\n  \"stream\": false,\n  \"model\": \"m\"\n}"))
+	if a != b {
+		t.Fatalf("hashes differ: %s != %s", a, b)
+	}
+	if a == RequestHash("POST", "/v1/chat/completions", []byte(`{"model":"other"}`)) {
+		t.Fatal("different bodies share a hash")
+	}
+}
@@ -0,0 +1,205 @@
+package emotion
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var assetTypes = map[string]string{
+	".png":  "image/png",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".svg":  "image/svg+xml",
+}
+
+// Asset is one image file of an emotion.
+type Asset struct {
+	// Name is the file name with the content hash inserted before the
+	// extension, e.g. "happy@2x.1a2b3c4d5e.png".
+	Name        string
+	Path        string
+	ContentType string
+	// Size is the density suffix of the file name ("1x" without one).
+	Size   string
+	Width  int
+	Height int
+}
+
+type emotionAssets struct {
+	variants []Asset
+	frames   []Asset
+}
+
+// Catalog indexes the emotion images in a directory:
+//
+//	happy.png, happy@2x.png, happy.webp   variants of "happy"
+//	happy/001.png, happy/002.png          animation frames of "happy"
+type Catalog struct {
+	emotions map[string]*emotionAssets
+	files    map[string]Asset
+}
+
+func LoadCatalog(dir string) (*Catalog, error) {
+	catalog := &Catalog{
+		emotions: map[string]*emotionAssets{},
+		files:    map[string]Asset{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.IsDir() {
+			if err := catalog.addFrames(dir, entry.Name()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if _, ok := assetTypes[ext]; !ok {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		name, size, _ := strings.Cut(base, "@")
+		if size == "" {
+			size = "1x"
+		}
+		asset, err := catalog.add(filepath.Join(dir, entry.Name()), entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		asset.Size = size
+		catalog.entry(name).variants = append(catalog.entry(name).variants, asset)
+	}
+	for _, assets := range catalog.emotions {
+		sort.Slice(assets.variants, func(i, j int) bool {
+			return assets.variants[i].Name < assets.variants[j].Name
+		})
+	}
+	return catalog, nil
+}
+
+func (c *Catalog) addFrames(dir, emotion string) error {
+	entries, err := os.ReadDir(filepath.Join(dir, emotion))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || assetTypes[ext] == "" {
+			continue
+		}
+		asset, err := c.add(filepath.Join(dir, emotion, entry.Name()), emotion+"/"+entry.Name())
+		if err != nil {
+			return err
+		}
+		c.entry(emotion).frames = append(c.entry(emotion).frames, asset)
+	}
+	return nil
+}
+
+func (c *Catalog) add(filePath, relName string) (Asset, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Asset{}, err
+	}
+	sum := sha256.Sum256(data)
+	ext := path.Ext(relName)
+	asset := Asset{
+		Name:        strings.TrimSuffix(relName, ext) + "." + hex.EncodeToString(sum[:5]) + ext,
+		Path:        filePath,
+		ContentType: assetTypes[strings.ToLower(ext)],
+	}
+	if asset.ContentType == "" {
+		asset.ContentType = mime.TypeByExtension(ext)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		asset.Width, asset.Height = cfg.Width, cfg.Height
+	}
+	c.files[asset.Name] = asset
+	c.files[relName] = asset
+	return asset, nil
+}
+
+func (c *Catalog) entry(emotion string) *emotionAssets {
+	emotion = strings.ToLower(emotion)
+	if c.emotions[emotion] == nil {
+		c.emotions[emotion] = &emotionAssets{}
+	}
+	return c.emotions[emotion]
+}
+
+// Lookup finds a file by its hashed name or by its plain name relative to the
+// catalog directory. hashed reports whether name carried the content hash.
+func (c *Catalog) Lookup(name string) (asset Asset, hashed bool, ok bool) {
+	asset, ok = c.files[name]
+	return asset, ok && asset.Name == name, ok
+}
+
+func (c *Catalog) has(emotion string) bool {
+	assets := c.emotions[emotion]
+	return assets != nil && (len(assets.variants) > 0 || len(assets.frames) > 0)
+}
+
+// Resolve follows fallbacks until it reaches an emotion that has assets.
+func (c *Catalog) Resolve(emotion string, fallbacks map[string]string) (string, error) {
+	seen := map[string]bool{}
+	current := strings.ToLower(strings.TrimSpace(emotion))
+	for !c.has(current) {
+		if seen[current] {
+			return "", fmt.Errorf("emotion %q: fallback cycle", emotion)
+		}
+		seen[current] = true
+		next, ok := fallbacks[current]
+		if !ok {
+			return "", fmt.Errorf("emotion %q has no asset and no fallback", emotion)
+		}
+		current = strings.ToLower(strings.TrimSpace(next))
+	}
+	return current, nil
+}
+
+// Validate checks that every emotion, and the default fallback if set, ends
+// up at an asset.
+func (c *Catalog) Validate(emotions []string, fallbacks map[string]string, defaultFallback string) error {
+	var problems []error
+	for _, e := range emotions {
+		if _, err := c.Resolve(e, fallbacks); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if defaultFallback != "" {
+		if _, err := c.Resolve(defaultFallback, fallbacks); err != nil {
+			problems = append(problems, fmt.Errorf("default fallback: %w", err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Variants returns the images and animation frames of an emotion that has
+// assets of its own.
+func (c *Catalog) Variants(emotion string) ([]Asset, []Asset) {
+	assets := c.emotions[strings.ToLower(emotion)]
+	if assets == nil {
+		return nil, nil
+	}
+	return assets.variants, assets.frames
+}
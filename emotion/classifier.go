@@ -0,0 +1,160 @@
+package emotion
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minEvidence is how many cue hits an opposite emotion needs before the
+// model's emotion counts as obviously wrong.
+const minEvidence = 2
+
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "don't": true, "doesn't": true, "isn't": true,
+	"wasn't": true, "aren't": true, "can't": true, "won't": true, "hardly": true,
+}
+
+// Classifier guesses the emotion of a reply from cue lists, without any
+// network access. It only ever returns emotions from its allowed list.
+type Classifier struct {
+	allowed  []string
+	entries  map[string]Entry
+	fallback string
+}
+
+type Result struct {
+	Emotion string
+	Score   float64
+}
+
+func NewClassifier(lexicon Lexicon, allowed []string) *Classifier {
+	c := &Classifier{entries: map[string]Entry{}}
+	for _, name := range allowed {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		c.allowed = append(c.allowed, name)
+		c.entries[name] = lexicon[name]
+		if c.fallback == "" {
+			c.fallback = name
+		}
+	}
+	// Text without any cue reads as neutral, if the avatar has such a face.
+	if _, ok := c.entries["neutral"]; ok {
+		c.fallback = "neutral"
+	}
+	if c.fallback == "" {
+		c.fallback = "neutral"
+	}
+	return c
+}
+
+// Classify returns the allowed emotion with the most cue hits in text, or the
+// fallback emotion with a zero score when nothing matched.
+func (c *Classifier) Classify(text string) Result {
+	scores := c.scores(text)
+	ranked := make([]string, 0, len(scores))
+	for name, score := range scores {
+		if score > 0 {
+			ranked = append(ranked, name)
+		}
+	}
+	if len(ranked) == 0 {
+		return Result{Emotion: c.fallback}
+	}
+	// Ties go to the emotion listed first in the allowed list.
+	order := make(map[string]int, len(c.allowed))
+	for i, name := range c.allowed {
+		order[name] = i
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return order[ranked[i]] < order[ranked[j]]
+	})
+	return Result{Emotion: ranked[0], Score: scores[ranked[0]]}
+}
+
+// Contradicts reports whether text clearly points to an emotion of the
+// opposite polarity than the given one: the best guess has at least
+// minEvidence hits while the given emotion has none.
+func (c *Classifier) Contradicts(emotion, text string) (Result, bool) {
+	given, ok := c.entries[emotion]
+	if !ok || given.Polarity == "" {
+		return Result{}, false
+	}
+	guess := c.Classify(text)
+	if guess.Score < minEvidence || guess.Emotion == emotion {
+		return guess, false
+	}
+	other := c.entries[guess.Emotion]
+	if other.Polarity == "" || other.Polarity == given.Polarity {
+		return guess, false
+	}
+	if c.scores(text)[emotion] > 0 {
+		return guess, false
+	}
+	return guess, true
+}
+
+func (c *Classifier) scores(text string) map[string]float64 {
+	lowered := strings.ToLower(text)
+	words := strings.FieldsFunc(lowered, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+
+	scores := make(map[string]float64, len(c.entries))
+	for name, entry := range c.entries {
+		for _, cue := range entry.Cues {
+			scores[name] += matchCue(cue, lowered, words)
+		}
+	}
+	if strings.Count(text, "!") >= 2 {
+		if _, ok := c.entries["excited"]; ok {
+			scores["excited"]++
+		}
+	}
+	return scores
+}
+
+// matchCue counts the occurrences of a cue. Single words are matched against
+// whole words and skipped right after a negation; anything else (phrases,
+// emoji, emoticons) is matched as a substring.
+func matchCue(cue, lowered string, words []string) float64 {
+	cue = strings.ToLower(strings.TrimSpace(cue))
+	if cue == "" {
+		return 0
+	}
+	prefix := strings.HasSuffix(cue, "*")
+	word := strings.TrimSuffix(cue, "*")
+	if !isWord(word) {
+		return float64(strings.Count(lowered, cue))
+	}
+
+	hits := 0.0
+	for i, w := range words {
+		if w != word && !(prefix && strings.HasPrefix(w, word)) {
+			continue
+		}
+		if i > 0 && negations[words[i-1]] {
+			continue
+		}
+		hits++
+	}
+	return hits
+}
+
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' {
+			return false
+		}
+	}
+	return true
+}
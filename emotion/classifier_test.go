@@ -0,0 +1,85 @@
+package emotion
+
+import "testing"
+
+var testEmotions = []string{"neutral", "happy", "sad", "angry", "confused", "amused", "thoughtful", "excited"}
+
+func TestClassify(t *testing.T) {
+	classifier := NewClassifier(DefaultLexicon(), testEmotions)
+	tests := []struct {
+		text  string
+		want  string
+		score float64
+	}{
+		{text: "The meeting is at noon.", want: "neutral"},
+		{text: "", want: "neutral"},
+		{text: "I'm so glad you came, thanks!", want: "happy", score: 2},
+		{text: "Sorry, that's sad news.", want: "sad", score: 2},
+		{text: "Haha, hahaha that joke is hilarious", want: "amused", score: 4},
+		{text: "Hmm, I'm confused about that.", want: "confused", score: 2},
+		{text: "I'm not happy about this.", want: "neutral"},
+		{text: "Never sad, never sorry", want: "neutral"},
+		{text: "Wow!! Let's go!", want: "excited", score: 3},
+		{text: "😢", want: "sad", score: 1},
+		{text: "GREAT", want: "happy", score: 1},
+		// Ties go to the emotion listed first.
+		{text: "happy and sad", want: "happy", score: 1},
+	}
+	for _, tt := range tests {
+		got := classifier.Classify(tt.text)
+		if got.Emotion != tt.want || got.Score != tt.score {
+			t.Errorf("Classify(%q) = %s/%v, want %s/%v", tt.text, got.Emotion, got.Score, tt.want, tt.score)
+		}
+	}
+}
+
+func TestClassifyAllowedOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		text    string
+		want    string
+	}{
+		{name: "guess not allowed", allowed: []string{"neutral", "sad"}, text: "Haha, so funny", want: "neutral"},
+		{name: "fallback without neutral", allowed: []string{" Happy ", "sad"}, text: "Nothing here", want: "happy"},
+		{name: "no emotions", allowed: nil, text: "I'm glad", want: "neutral"},
+		{name: "custom emotion without cues", allowed: []string{"sleepy", "sad"}, text: "Sorry", want: "sad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClassifier(DefaultLexicon(), tt.allowed).Classify(tt.text).Emotion; got != tt.want {
+				t.Fatalf("Classify(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContradicts(t *testing.T) {
+	classifier := NewClassifier(DefaultLexicon(), testEmotions)
+	tests := []struct {
+		name    string
+		emotion string
+		text    string
+		guess   string
+		want    bool
+	}{
+		{name: "opposite polarity", emotion: "happy", text: "Sorry, that's sad. I miss her.", guess: "sad", want: true},
+		{name: "one hit is not enough", emotion: "happy", text: "Sorry to hear that.", want: false},
+		{name: "same polarity", emotion: "happy", text: "Haha, so funny!", want: false},
+		{name: "given emotion has hits", emotion: "happy", text: "Glad you asked, sorry it is sad.", want: false},
+		{name: "no polarity", emotion: "thoughtful", text: "Sorry, that's sad. I miss her.", want: false},
+		{name: "guess without polarity", emotion: "happy", text: "Hmm, confusing, not sure.", want: false},
+		{name: "unknown emotion", emotion: "sleepy", text: "Sorry, that's sad. I miss her.", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guess, got := classifier.Contradicts(tt.emotion, tt.text)
+			if got != tt.want {
+				t.Fatalf("Contradicts(%s, %q) = %v (guess %s), want %v", tt.emotion, tt.text, got, guess.Emotion, tt.want)
+			}
+			if tt.want && guess.Emotion != tt.guess {
+				t.Fatalf("guess = %s, want %s", guess.Emotion, tt.guess)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package emotion
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Definition tells the model what an emotion means and when to pick it.
+type Definition struct {
+	Name        string   `yaml:"-"`
+	Description string   `yaml:"description"`
+	Triggers    []string `yaml:"triggers"`
+	// Weight is how strongly the emotion is preferred when several fit.
+	// 1 is neutral; 0 means unset and is treated as 1.
+	Weight float64 `yaml:"weight"`
+}
+
+var defaultDefinitions = map[string]Definition{
+	"neutral": {
+		Description: "Calm and matter-of-fact. The default when nothing stands out.",
+		Triggers:    []string{"plain questions", "factual answers", "small talk"},
+	},
+	"happy": {
+		Description: "Warm and pleased.",
+		Triggers:    []string{"greetings", "compliments", "thanks", "good news"},
+	},
+	"sad": {
+		Description: "Sympathetic or disappointed.",
+		Triggers:    []string{"the visitor shares bad news", "apologizing", "saying goodbye"},
+	},
+	"angry": {
+		Description: "Annoyed. Use sparingly and never at the visitor.",
+		Triggers:    []string{"talking about something unfair", "repeated rudeness"},
+		Weight:      0.5,
+	},
+	"confused": {
+		Description: "Unsure what the visitor means and asking to clarify.",
+		Triggers:    []string{"ambiguous or garbled messages", "missing context"},
+	},
+	"amused": {
+		Description: "Finding something funny.",
+		Triggers:    []string{"jokes", "puns", "ironic situations"},
+	},
+	"thoughtful": {
+		Description: "Considering a question that has no quick answer.",
+		Triggers:    []string{"opinions", "advice", "trade-offs", "personal questions"},
+	},
+	"excited": {
+		Description: "Enthusiastic, more energetic than happy.",
+		Triggers:    []string{"favorite topics", "big news", "plans and launches"},
+	},
+}
+
+// NormalizeName lowercases and trims an emotion name.
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Validate checks the name and weight of a definition.
+func (d Definition) Validate() error {
+	if !namePattern.MatchString(d.Name) {
+		return fmt.Errorf("emotion name %q must be lowercase letters, digits, '-' or '_'", d.Name)
+	}
+	if d.Weight < 0 {
+		return fmt.Errorf("emotion %q: weight must not be negative", d.Name)
+	}
+	return nil
+}
+
+// LoadDefinitions returns definitions for names, taken from the YAML file at
+// path when it has them and from the built-in defaults otherwise, e.g.
+//
+//	thoughtful:
+//	  description: Considering a question that has no quick answer.
+//	  triggers: [opinions, advice]
+//	  weight: 1.5
+func LoadDefinitions(path string, names []string) ([]Definition, error) {
+	custom := map[string]Definition{}
+	if strings.TrimSpace(path) != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+
+	defs := make([]Definition, 0, len(names))
+	for _, name := range names {
+		name = NormalizeName(name)
+		if name == "" {
+			continue
+		}
+		def, ok := custom[name]
+		if !ok {
+			def = defaultDefinitions[name]
+		}
+		def.Name = name
+		if err := def.Validate(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// Set is the emotion set currently offered to the model. It can be replaced
+// at runtime and is safe for concurrent use.
+type Set struct {
+	mu   sync.RWMutex
+	defs []Definition
+}
+
+func NewSet(defs []Definition) *Set {
+	s := &Set{}
+	s.Replace(defs)
+	return s
+}
+
+// Replace swaps in a new list of definitions, keeping their order.
+func (s *Set) Replace(defs []Definition) {
+	copied := make([]Definition, 0, len(defs))
+	for _, def := range defs {
+		def.Name = NormalizeName(def.Name)
+		def.Triggers = append([]string(nil), def.Triggers...)
+		copied = append(copied, def)
+	}
+	s.mu.Lock()
+	s.defs = copied
+	s.mu.Unlock()
+}
+
+func (s *Set) Definitions() []Definition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Definition(nil), s.defs...)
+}
+
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.defs))
+	for _, def := range s.defs {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+// Guidance describes the emotions for the model, one line per emotion that
+// has a description, triggers or a non-default weight. It is empty when none
+// has any.
+func Guidance(defs []Definition) string {
+	var b strings.Builder
+	for _, def := range defs {
+		if def.Description == "" && len(def.Triggers) == 0 && (def.Weight == 0 || def.Weight == 1) {
+			continue
+		}
+		b.WriteString("- ")
+		b.WriteString(def.Name)
+		if def.Weight != 0 && def.Weight != 1 {
+			fmt.Fprintf(&b, " (weight %g)", def.Weight)
+		}
+		if def.Description != "" {
+			b.WriteString(": ")
+			b.WriteString(strings.TrimSpace(def.Description))
+		}
+		if len(def.Triggers) > 0 {
+			b.WriteString(" Examples: ")
+			b.WriteString(strings.Join(def.Triggers, "; "))
+			b.WriteString(".")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
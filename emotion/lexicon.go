@@ -0,0 +1,112 @@
+package emotion
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Entry describes how to recognize one emotion in text.
+type Entry struct {
+	// Polarity is "positive", "negative" or empty. Only emotions with
+	// opposite polarities count as obviously mismatched.
+	Polarity string `yaml:"polarity"`
+	// Cues are lowercase words, phrases or emoji. A word ending in "*"
+	// matches any word with that prefix.
+	Cues []string `yaml:"cues"`
+}
+
+// Lexicon maps emotion names to their cues.
+type Lexicon map[string]Entry
+
+// DefaultLexicon covers the default AI_EMOTIONS.
+func DefaultLexicon() Lexicon {
+	return Lexicon{
+		"happy": {
+			Polarity: "positive",
+			Cues: []string{
+				"happy", "glad", "great", "love", "lovely", "nice", "wonderful", "awesome", "thanks", "thank",
+				"enjoy*", "pleased", "delighted", "cheers", "welcome", "good to", "nice to meet",
+				"😊", "🙂", "😄", "😀", ":)", ":-)", "❤️",
+			},
+		},
+		"excited": {
+			Polarity: "positive",
+			Cues: []string{
+				"excited", "exciting", "amazing", "incredible", "can't wait", "cannot wait", "thrilled",
+				"fantastic", "wow", "woohoo", "yay", "let's go", "super cool",
+				"🚀", "🎉", "🤩", "🔥",
+			},
+		},
+		"amused": {
+			Polarity: "positive",
+			Cues: []string{
+				"haha*", "hehe*", "lol", "lmao", "funny", "hilarious", "joke*", "kidding", "amusing", "ironic*",
+				"😂", "🤣", "😆", "😄", ";)", "😉",
+			},
+		},
+		"sad": {
+			Polarity: "negative",
+			Cues: []string{
+				"sad", "sorry", "unfortunately", "miss", "missed", "lost", "loss", "regret*", "disappoint*",
+				"heartbroken", "hard time", "tough time", "painful", "passed away",
+				"😢", "😞", "☹️", ":(", ":-(",
+			},
+		},
+		"angry": {
+			Polarity: "negative",
+			Cues: []string{
+				"angry", "annoy*", "furious", "mad", "frustrat*", "hate", "unacceptable", "ridiculous",
+				"outrageous", "fed up", "rude", "stop it",
+				"😠", "😡", "🤬",
+			},
+		},
+		"confused": {
+			Cues: []string{
+				"confus*", "not sure", "unclear", "don't understand", "do not understand", "what do you mean",
+				"puzzl*", "no idea", "lost me", "hmm",
+				"😕", "🤔", "🤨",
+			},
+		},
+		"thoughtful": {
+			Cues: []string{
+				"think", "thinking", "consider*", "reflect*", "perhaps", "maybe", "interesting question",
+				"depends", "on the other hand", "in my experience", "i believe", "tradeoff*", "trade-off*",
+			},
+		},
+		"neutral": {},
+	}
+}
+
+// LoadLexicon reads a YAML lexicon, e.g.
+//
+//	happy:
+//	  polarity: positive
+//	  cues: [glad, "😊"]
+//
+// Emotions in the file replace the defaults; others keep their default cues.
+func LoadLexicon(path string) (Lexicon, error) {
+	lexicon := DefaultLexicon()
+	if strings.TrimSpace(path) == "" {
+		return lexicon, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var custom Lexicon
+	if err := yaml.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name, entry := range custom {
+		switch entry.Polarity {
+		case "", "positive", "negative":
+		default:
+			return nil, fmt.Errorf("%s: emotion %q has unknown polarity %q", path, name, entry.Polarity)
+		}
+		lexicon[strings.ToLower(strings.TrimSpace(name))] = entry
+	}
+	return lexicon, nil
+}
@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/lang"
+)
+
+// check returns a description of every assertion the reply fails.
+func check(a Assertions, reply ai.Reply) []string {
+	var failures []string
+
+	if len(a.EmotionIn) > 0 {
+		found := false
+		for _, emotion := range a.EmotionIn {
+			if strings.EqualFold(strings.TrimSpace(emotion), reply.Emotion) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("emotion %q not in %v", reply.Emotion, a.EmotionIn))
+		}
+	}
+
+	length := utf8.RuneCountInString(reply.Text)
+	if a.MinLength > 0 && length < a.MinLength {
+		failures = append(failures, fmt.Sprintf("reply has %d characters, want at least %d", length, a.MinLength))
+	}
+	if a.MaxLength > 0 && length > a.MaxLength {
+		failures = append(failures, fmt.Sprintf("reply has %d characters, want at most %d", length, a.MaxLength))
+	}
+
+	for _, pattern := range a.MustMatch {
+		if !regexp.MustCompile(pattern).MatchString(reply.Text) {
+			failures = append(failures, fmt.Sprintf("reply does not match %q", pattern))
+		}
+	}
+	for _, pattern := range a.MustNotMatch {
+		if regexp.MustCompile(pattern).MatchString(reply.Text) {
+			failures = append(failures, fmt.Sprintf("reply matches %q", pattern))
+		}
+	}
+
+	if a.ValidJSON != nil && *a.ValidJSON != reply.Structured {
+		if reply.Structured {
+			failures = append(failures, "model answered with JSON, want free text")
+		} else {
+			failures = append(failures, "model did not answer with the reply JSON")
+		}
+	}
+
+	if a.Language != "" {
+		want := lang.Normalize(a.Language)
+		if reply.Language != want {
+			got := reply.Language
+			if got == "" {
+				got = "undetermined"
+			}
+			failures = append(failures, fmt.Sprintf("reply language is %s, want %s", got, want))
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,146 @@
+package eval
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/models"
+	"talk-to-ugur-back/web/handlers"
+)
+
+// Main runs the eval subcommand and returns the process exit code: 0 when
+// every case of the last variant passed, 1 when some failed and 2 on usage or
+// setup errors.
+func Main(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	suitePath := flags.String("suite", "", "path to the YAML suite (required)")
+	model := flags.String("model", "", "model for variant A (default OPENAI_MODEL)")
+	promptPath := flags.String("prompt", "", "system prompt file for variant A (default AI_SYSTEM_PROMPT_PATH)")
+	compareModel := flags.String("compare-model", "", "model for variant B")
+	comparePrompt := flags.String("compare-prompt", "", "system prompt file for variant B")
+	judgeEnabled := flags.Bool("judge", false, "score cases that have judge criteria with an LLM judge")
+	judgeModel := flags.String("judge-model", "", "model for the judge (default OPENAI_MODEL)")
+	provider := flags.String("provider", "", "openai or replay (default AI_PROVIDER)")
+	replayPath := flags.String("replay", "", "transcript for the replay provider (default AI_REPLAY_PATH)")
+	emotionSource := flags.String("emotions", "db", "db loads the emotion set from the database like the server, config uses AI_EMOTIONS")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: talk-to-ugur-back eval -suite evals/persona.yaml [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *suitePath == "" {
+		flags.Usage()
+		return 2
+	}
+
+	suite, err := LoadSuite(*suitePath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	cfg, err := config.LoadConfig(ctx)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *provider != "" {
+		cfg.AIProvider = *provider
+	}
+	if *replayPath != "" {
+		cfg.AIReplayPath = *replayPath
+	}
+
+	var emotions []emotion.Definition
+	switch *emotionSource {
+	case "db":
+		if emotions, err = loadEmotions(ctx, cfg); err != nil {
+			fmt.Fprintf(stderr, "load emotions: %v\n", err)
+			return 2
+		}
+	case "config":
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	base := Variant{
+		Model:      valueOr(*model, cfg.OpenAIModel),
+		PromptPath: valueOr(*promptPath, cfg.AISystemPromptPath),
+	}
+	variants := []Variant{base}
+	if *compareModel != "" || *comparePrompt != "" {
+		variants = append(variants, Variant{
+			Model:      valueOr(*compareModel, base.Model),
+			PromptPath: valueOr(*comparePrompt, base.PromptPath),
+		})
+	}
+
+	var judgeClient *ai.Client
+	if *judgeEnabled {
+		judgeCfg := *cfg
+		judgeCfg.OpenAIModel = valueOr(*judgeModel, cfg.OpenAIModel)
+		judgeCfg.AIRecordPath = ""
+		if judgeClient, err = ai.NewClient(&judgeCfg); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	results := make([][]Result, 0, len(variants))
+	for i, variant := range variants {
+		fmt.Fprintf(stderr, "running %s (%d cases)...\n", columnName(i), len(suite.Cases))
+		variantResults, err := Run(ctx, *cfg, suite, variant, emotions, judgeClient)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		results = append(results, variantResults)
+	}
+
+	Report(stdout, suite, variants, results)
+
+	for _, r := range results[len(results)-1] {
+		if !r.Passed() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// loadEmotions reads the emotion set the server uses from the database. An
+// empty table is seeded with the configured set, as on the server's first
+// start.
+func loadEmotions(ctx context.Context, cfg *config.Config) ([]emotion.Definition, error) {
+	pool, err := pgxpool.New(ctx, cfg.PostgresConnString)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Close()
+
+	client, err := ai.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	set := client.Emotions()
+	if err := handlers.LoadEmotions(ctx, models.NewStore(pool).Queries, set); err != nil {
+		return nil, err
+	}
+	return set.Definitions(), nil
+}
+
+func valueOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
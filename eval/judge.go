@@ -0,0 +1,43 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"talk-to-ugur-back/ai"
+)
+
+const judgeSystemPrompt = `You grade replies of a chatbot that impersonates a person on their website.
+You get the conversation, the reply under test and the criteria it should meet.
+Answer with a JSON object {"score": <integer 1-5>, "reason": "<one sentence>"}, where 5 means the criteria are fully met and 1 means not at all.`
+
+type judgement struct {
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// judge asks the judge model to score reply against the case's criteria.
+func judge(ctx context.Context, client *ai.Client, c Case, reply ai.Reply) (judgement, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Conversation:\n")
+	for _, m := range c.Messages {
+		fmt.Fprintf(&prompt, "%s: %s\n", m.Role, m.Content)
+	}
+	fmt.Fprintf(&prompt, "\nReply under test (emotion %q):\n%s\n", reply.Emotion, reply.Text)
+	fmt.Fprintf(&prompt, "\nCriteria:\n%s\n", strings.TrimSpace(c.Judge))
+
+	raw, err := client.CompleteJSON(ctx, judgeSystemPrompt, prompt.String())
+	if err != nil {
+		return judgement{}, err
+	}
+	var result judgement
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		return judgement{}, fmt.Errorf("invalid judge answer %q: %w", raw, err)
+	}
+	if result.Score < 1 || result.Score > 5 {
+		return judgement{}, fmt.Errorf("judge score %d out of range", result.Score)
+	}
+	return result, nil
+}
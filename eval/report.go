@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Report prints one column per variant and, with two variants, the cases
+// whose outcome changed between them.
+func Report(w io.Writer, suite Suite, variants []Variant, results [][]Result) {
+	name := suite.Name
+	if name == "" {
+		name = "suite"
+	}
+	fmt.Fprintf(w, "%s: %d cases\n", name, len(suite.Cases))
+	for i, v := range variants {
+		fmt.Fprintf(w, "  %s: model=%s prompt=%s\n", columnName(i), v.Model, v.PromptPath)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"CASE"}
+	for i := range variants {
+		header = append(header, columnName(i))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i, c := range suite.Cases {
+		row := []string{c.Name}
+		for _, variantResults := range results {
+			row = append(row, formatCell(variantResults[i]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintln(w)
+	for i, variantResults := range results {
+		fmt.Fprintf(w, "%s: %s\n", columnName(i), summarize(variantResults))
+	}
+
+	if len(results) == 2 {
+		var regressions, improvements []string
+		for i, c := range suite.Cases {
+			before, after := results[0][i].Passed(), results[1][i].Passed()
+			switch {
+			case before && !after:
+				regressions = append(regressions, c.Name)
+			case !before && after:
+				improvements = append(improvements, c.Name)
+			}
+		}
+		fmt.Fprintf(w, "regressions (A pass, B fail): %s\n", listOrNone(regressions))
+		fmt.Fprintf(w, "improvements (A fail, B pass): %s\n", listOrNone(improvements))
+	}
+
+	printed := false
+	for i, variantResults := range results {
+		for _, r := range variantResults {
+			if r.Passed() && r.Reason == "" {
+				continue
+			}
+			if !printed {
+				fmt.Fprintln(w, "\ndetails:")
+				printed = true
+			}
+			if r.Err != nil {
+				fmt.Fprintf(w, "  [%s] %s: error: %v\n", columnName(i), r.Case, r.Err)
+				continue
+			}
+			for _, failure := range r.Failures {
+				fmt.Fprintf(w, "  [%s] %s: %s\n", columnName(i), r.Case, failure)
+			}
+			if r.Reason != "" {
+				fmt.Fprintf(w, "  [%s] %s: judge: %s\n", columnName(i), r.Case, r.Reason)
+			}
+		}
+	}
+}
+
+func columnName(i int) string {
+	return string(rune('A' + i))
+}
+
+func formatCell(r Result) string {
+	if r.Err != nil {
+		return "ERROR"
+	}
+	status := "pass"
+	if !r.Passed() {
+		status = fmt.Sprintf("FAIL(%d)", len(r.Failures))
+	}
+	score := "-"
+	if r.Score > 0 {
+		score = fmt.Sprintf("%d/5", r.Score)
+	}
+	return fmt.Sprintf("%s %s %s %s", status, r.Reply.Emotion, score, r.Duration.Round(time.Millisecond))
+}
+
+func summarize(results []Result) string {
+	passed, judged, scoreSum := 0, 0, 0
+	var total time.Duration
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+		}
+		if r.Score > 0 {
+			judged++
+			scoreSum += r.Score
+		}
+		total += r.Duration
+	}
+	summary := fmt.Sprintf("%d/%d passed", passed, len(results))
+	if judged > 0 {
+		summary += fmt.Sprintf(", judge avg %.2f over %d", float64(scoreSum)/float64(judged), judged)
+	}
+	if len(results) > 0 {
+		summary += fmt.Sprintf(", avg latency %s", (total / time.Duration(len(results))).Round(time.Millisecond))
+	}
+	return summary
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,78 @@
+package eval
+
+import (
+	"context"
+	"time"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/models/db"
+)
+
+// Variant is one configuration under test.
+type Variant struct {
+	Model      string
+	PromptPath string
+}
+
+type Result struct {
+	Case     string
+	Reply    ai.Reply
+	Err      error
+	Failures []string
+	// Score is the judge's 1-5 score, 0 when the case was not judged.
+	Score    int
+	Reason   string
+	Duration time.Duration
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run sends every case of the suite through a client configured for variant.
+// emotions replaces the configured emotion set unless nil. judgeClient may be
+// nil to skip judging.
+func Run(ctx context.Context, cfg config.Config, suite Suite, variant Variant, emotions []emotion.Definition, judgeClient *ai.Client) ([]Result, error) {
+	cfg.OpenAIModel = variant.Model
+	cfg.AISystemPromptPath = variant.PromptPath
+	// Captured prompts are only useful when stored next to a message.
+	cfg.AIPromptCaptureEnabled = false
+	client, err := ai.NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	if emotions != nil {
+		client.Emotions().Replace(emotions)
+	}
+
+	results := make([]Result, 0, len(suite.Cases))
+	for _, c := range suite.Cases {
+		history := make([]db.ChatMessage, 0, len(c.Messages))
+		for _, m := range c.Messages {
+			history = append(history, db.ChatMessage{Role: m.Role, Content: m.Content})
+		}
+
+		start := time.Now()
+		reply, err := client.GenerateReply(ctx, history, ai.ReplyOptions{Language: c.ReplyLanguage})
+		result := Result{Case: c.Name, Reply: reply, Err: err, Duration: time.Since(start)}
+		if err == nil {
+			result.Failures = check(suite.assertions(c), reply)
+			if judgeClient != nil && c.Judge != "" {
+				if verdict, err := judge(ctx, judgeClient, c, reply); err != nil {
+					result.Reason = "judge error: " + err.Error()
+				} else {
+					result.Score = verdict.Score
+					result.Reason = verdict.Reason
+				}
+			}
+		}
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of conversations to run through the model, loaded from YAML.
+type Suite struct {
+	Name string `yaml:"name"`
+	// Defaults are merged into every case's assertions; fields set on a case
+	// win.
+	Defaults Assertions `yaml:"defaults"`
+	Cases    []Case     `yaml:"cases"`
+}
+
+type Case struct {
+	Name     string    `yaml:"name"`
+	Messages []Message `yaml:"messages"`
+	// ReplyLanguage is passed to the client as the required reply language.
+	ReplyLanguage string     `yaml:"reply_language"`
+	Assert        Assertions `yaml:"assert"`
+	// Judge holds criteria for the optional LLM judge.
+	Judge string `yaml:"judge"`
+}
+
+type Message struct {
+	Role    string `yaml:"role"`
+	Content string `yaml:"content"`
+}
+
+type Assertions struct {
+	EmotionIn    []string `yaml:"emotion_in"`
+	MinLength    int      `yaml:"min_length"`
+	MaxLength    int      `yaml:"max_length"`
+	MustMatch    []string `yaml:"must_match"`
+	MustNotMatch []string `yaml:"must_not_match"`
+	// ValidJSON requires the model to have answered with the structured JSON
+	// reply rather than free text.
+	ValidJSON *bool  `yaml:"valid_json"`
+	Language  string `yaml:"language"`
+}
+
+func LoadSuite(path string) (Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Suite{}, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return Suite{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := suite.validate(); err != nil {
+		return Suite{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite, nil
+}
+
+func (s Suite) validate() error {
+	if len(s.Cases) == 0 {
+		return errors.New("suite has no cases")
+	}
+	seen := map[string]bool{}
+	for i, c := range s.Cases {
+		if strings.TrimSpace(c.Name) == "" {
+			return fmt.Errorf("case %d has no name", i+1)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate case %q", c.Name)
+		}
+		seen[c.Name] = true
+		if len(c.Messages) == 0 || c.Messages[len(c.Messages)-1].Role != "user" {
+			return fmt.Errorf("case %q must end with a user message", c.Name)
+		}
+		for _, m := range c.Messages {
+			if m.Role != "user" && m.Role != "assistant" {
+				return fmt.Errorf("case %q: unknown role %q", c.Name, m.Role)
+			}
+		}
+		for _, pattern := range append(s.assertions(c).MustMatch, s.assertions(c).MustNotMatch...) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("case %q: %w", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// assertions returns the case's assertions with the suite defaults filled in.
+func (s Suite) assertions(c Case) Assertions {
+	merged := c.Assert
+	if len(merged.EmotionIn) == 0 {
+		merged.EmotionIn = s.Defaults.EmotionIn
+	}
+	if merged.MinLength == 0 {
+		merged.MinLength = s.Defaults.MinLength
+	}
+	if merged.MaxLength == 0 {
+		merged.MaxLength = s.Defaults.MaxLength
+	}
+	merged.MustMatch = append(append([]string(nil), s.Defaults.MustMatch...), merged.MustMatch...)
+	merged.MustNotMatch = append(append([]string(nil), s.Defaults.MustNotMatch...), merged.MustNotMatch...)
+	if merged.ValidJSON == nil {
+		merged.ValidJSON = s.Defaults.ValidJSON
+	}
+	if merged.Language == "" {
+		merged.Language = s.Defaults.Language
+	}
+	return merged
+}
@@ -0,0 +1,176 @@
+package lang
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Detection struct {
+	Code       string
+	Confidence float64
+}
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "what", "this", "that", "with", "for", "have", "do", "does", "not", "your", "how", "was", "it's", "i'm", "my", "of", "to", "in", "can", "about", "would", "hello", "hi", "hey", "what's", "thanks", "why", "think", "up"},
+	"tr": {"ve", "bir", "bu", "ne", "nasıl", "mı", "mi", "mu", "mü", "için", "ben", "sen", "çok", "var", "yok", "da", "de", "ile", "gibi", "merhaba", "neden", "evet", "hayır", "teşekkürler", "şey", "değil", "musun", "misin", "nasılsın", "olarak"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "sie", "wie", "was", "ein", "eine", "mit", "für", "auf", "auch", "es", "warum", "hallo", "danke", "bist", "sind", "haben", "dein", "mein", "aber", "wir", "wo", "kannst"},
+	"fr": {"le", "la", "les", "et", "est", "je", "tu", "vous", "que", "qui", "une", "des", "pour", "pas", "dans", "sur", "avec", "ce", "bonjour", "merci", "pourquoi", "comment", "quoi", "suis", "êtes", "c'est", "mon", "ton", "mais", "ou"},
+	"es": {"el", "los", "las", "y", "es", "yo", "tú", "usted", "que", "qué", "una", "por", "para", "con", "del", "no", "hola", "gracias", "cómo", "como", "estás", "eres", "pero", "muy", "también", "mi", "tu", "sí", "porque", "dónde"},
+	"it": {"il", "lo", "gli", "e", "è", "io", "che", "una", "per", "non", "con", "sono", "sei", "ciao", "grazie", "come", "perché", "cosa", "mio", "tuo", "ma", "anche", "della", "questo", "quello", "dove", "stai", "hai", "molto", "bene"},
+	"pt": {"o", "os", "as", "e", "é", "eu", "você", "que", "uma", "um", "por", "para", "com", "não", "olá", "oi", "obrigado", "obrigada", "como", "está", "meu", "seu", "mas", "também", "isso", "muito", "onde", "porque", "são", "tudo"},
+	"nl": {"de", "het", "een", "en", "is", "ik", "jij", "je", "niet", "wat", "hoe", "met", "voor", "op", "van", "dat", "dit", "hallo", "dank", "waarom", "ben", "bent", "zijn", "mijn", "jouw", "maar", "ook", "waar", "kun", "heb"},
+	"pl": {"i", "w", "nie", "to", "jest", "się", "na", "że", "co", "jak", "ja", "ty", "czy", "dla", "z", "cześć", "dziękuję", "dlaczego", "jestem", "jesteś", "mój", "twój", "ale", "też", "gdzie", "bardzo", "tak", "proszę", "mam", "masz"},
+}
+
+var letterHints = map[string]string{
+	"tr": "ğşıİ",
+	"de": "ßäöü",
+	"es": "ñ¿¡",
+	"fr": "çœèêëàâîôûù",
+	"pt": "ãõç",
+	"pl": "ąćęłńśźż",
+}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopwords))
+	for code, words := range stopwords {
+		set := make(map[string]bool, len(words))
+		for _, w := range words {
+			set[w] = true
+		}
+		sets[code] = set
+	}
+	return sets
+}()
+
+// IsStopword reports whether the lowercase word is a stopword in any of the
+// detected languages.
+func IsStopword(word string) bool {
+	for _, set := range stopwordSets {
+		if set[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect guesses the language of a short chat message without any network
+// access. Non-Latin scripts are identified by their script; Latin text is
+// scored against per-language stopword lists and characteristic letters. An
+// empty Code means the text was too short or ambiguous to call.
+func Detect(text string) Detection {
+	if code, confidence, ok := detectScript(text); ok {
+		return Detection{Code: code, Confidence: confidence}
+	}
+	return detectLatin(text)
+}
+
+func detectScript(text string) (string, float64, bool) {
+	counts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			counts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		}
+	}
+	if letters == 0 {
+		return "", 0, false
+	}
+
+	// Japanese mixes kana with kanji; Han characters without kana are Chinese.
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["han"]
+	} else {
+		counts["zh"] = counts["han"]
+	}
+	delete(counts, "han")
+
+	best, bestCount := "", 0
+	for code, count := range counts {
+		if count > bestCount {
+			best, bestCount = code, count
+		}
+	}
+	share := float64(bestCount) / float64(letters)
+	if share < 0.5 {
+		return "", 0, false
+	}
+	return best, share, true
+}
+
+func detectLatin(text string) Detection {
+	lowered := strings.ToLower(text)
+	words := strings.FieldsFunc(lowered, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) == 0 {
+		return Detection{}
+	}
+
+	scores := map[string]float64{}
+	for _, word := range words {
+		for code, set := range stopwordSets {
+			if set[word] {
+				scores[code]++
+			}
+		}
+	}
+	for code, hints := range letterHints {
+		for _, r := range lowered {
+			if strings.ContainsRune(hints, r) {
+				scores[code] += 0.5
+			}
+		}
+	}
+
+	ranked := make([]string, 0, len(scores))
+	for code := range scores {
+		ranked = append(ranked, code)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) == 0 || scores[ranked[0]] < 1 {
+		return Detection{}
+	}
+	best := ranked[0]
+	second := 0.0
+	if len(ranked) > 1 {
+		second = scores[ranked[1]]
+	}
+	if second == scores[best] {
+		return Detection{}
+	}
+
+	margin := scores[best] - second
+	confidence := margin / float64(len(words))
+	if confidence > 1 {
+		confidence = 1
+	}
+	return Detection{Code: best, Confidence: confidence}
+}
@@ -0,0 +1,95 @@
+package lang
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var names = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"tr": "Turkish",
+	"zh": "Chinese",
+}
+
+// Name returns the English name of a language code, or the code itself if it
+// is not known.
+func Name(code string) string {
+	code = Normalize(code)
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// Normalize reduces a BCP 47 tag such as "en-US" or "pt_BR" to its lowercase
+// primary language subtag.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
+
+// ParseAcceptLanguage returns the normalized languages of an Accept-Language
+// header ordered by preference, without duplicates.
+func ParseAcceptLanguage(header string) []string {
+	type entry struct {
+		code string
+		q    float64
+	}
+	var entries []entry
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		code := Normalize(fields[0])
+		if code == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		entries = append(entries, entry{code: code, q: q})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].q > entries[j].q
+	})
+
+	seen := map[string]bool{}
+	codes := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if seen[e.code] {
+			continue
+		}
+		seen[e.code] = true
+		codes = append(codes, e.code)
+	}
+	return codes
+}
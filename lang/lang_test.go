@@ -0,0 +1,117 @@
+package lang
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Hello, how are you doing today?", want: "en"},
+		{text: "Merhaba, nasılsın? Bu çok güzel bir gün.", want: "tr"},
+		{text: "Hallo, wie geht es dir? Ich bin müde.", want: "de"},
+		{text: "Bonjour, comment allez-vous? Je suis content.", want: "fr"},
+		{text: "Hola, ¿cómo estás? Yo estoy muy bien.", want: "es"},
+		{text: "Ciao, come stai? Io sono molto bene.", want: "it"},
+		{text: "Olá, você está bem? Eu não sei.", want: "pt"},
+		{text: "Hallo, hoe gaat het met jou? Ik ben blij.", want: "nl"},
+		{text: "Cześć, jak się masz? To jest bardzo dobre.", want: "pl"},
+		{text: "Привет, как дела?", want: "ru"},
+		{text: "こんにちは、元気ですか？", want: "ja"},
+		{text: "你好，你今天怎么样？", want: "zh"},
+		{text: "안녕하세요, 잘 지내세요?", want: "ko"},
+		{text: "مرحبا كيف حالك", want: "ar"},
+		{text: "שלום מה שלומך", want: "he"},
+		{text: "Γεια σου, τι κάνεις;", want: "el"},
+		{text: "สวัสดีครับ", want: "th"},
+		{text: "नमस्ते, आप कैसे हैं?", want: "hi"},
+		// Too short or ambiguous to call.
+		{text: "", want: ""},
+		{text: "👍 123 !!", want: ""},
+		{text: "Ugur", want: ""},
+		{text: "de", want: ""},
+		// Mostly Latin with a few Cyrillic letters is not Russian.
+		{text: "I'm reading Пушкин in the original, it is hard", want: "en"},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.text); got.Code != tt.want {
+			t.Errorf("Detect(%q) = %q (%.2f), want %q", tt.text, got.Code, got.Confidence, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"en":      "en",
+		"en-US":   "en",
+		" pt_BR ": "pt",
+		"TR":      "tr",
+		"*":       "",
+		"":        "",
+	}
+	for tag, want := range tests {
+		if got := Normalize(tag); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := map[string]string{
+		"tr":    "Turkish",
+		"de-AT": "German",
+		"xx":    "xx",
+	}
+	for code, want := range tests {
+		if got := Name(code); got != want {
+			t.Errorf("Name(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: []string{}},
+		{header: "en-US,en;q=0.9,tr;q=0.8", want: []string{"en", "tr"}},
+		{header: "de;q=0.5, fr;q=0.9, it", want: []string{"it", "fr", "de"}},
+		{header: "tr, en;q=0, *;q=0.1", want: []string{"tr"}},
+		{header: "es;q=bad, pt", want: []string{"es", "pt"}},
+	}
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		detected string
+		accept   []string
+		want     string
+	}{
+		{name: "visitor uses the message", policy: NewPolicy("", "en", nil), detected: "tr", accept: []string{"de"}, want: "tr"},
+		{name: "visitor falls back to the header", policy: NewPolicy("visitor", "en", nil), accept: []string{"de", "fr"}, want: "de"},
+		{name: "visitor falls back to the default", policy: NewPolicy("visitor", "en", nil), want: "en"},
+		{name: "visitor without default", policy: NewPolicy("visitor", "", nil), want: ""},
+		{name: "fixed", policy: NewPolicy("Fixed", "en-GB", nil), detected: "tr", accept: []string{"tr"}, want: "en"},
+		{name: "whitelist allows the message", policy: NewPolicy("whitelist", "en", []string{"en", "tr"}), detected: "tr", want: "tr"},
+		{name: "whitelist skips to the header", policy: NewPolicy("whitelist", "en", []string{"en", "TR-tr"}), detected: "de", accept: []string{"fr", "tr"}, want: "tr"},
+		{name: "whitelist falls back", policy: NewPolicy("whitelist", "en", []string{"en", "tr"}), detected: "de", accept: []string{"fr"}, want: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Resolve(tt.detected, tt.accept); got != tt.want {
+				t.Fatalf("Resolve(%q, %q) = %q, want %q", tt.detected, tt.accept, got, tt.want)
+			}
+		})
+	}
+}
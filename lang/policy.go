@@ -0,0 +1,73 @@
+package lang
+
+import (
+	"strings"
+)
+
+const (
+	PolicyVisitor   = "visitor"
+	PolicyFixed     = "fixed"
+	PolicyWhitelist = "whitelist"
+)
+
+// Policy decides which language the persona replies in.
+//
+//   - visitor: the language of the visitor's message, then their
+//     Accept-Language header, then Fallback
+//   - fixed: always Fallback
+//   - whitelist: like visitor, but only languages in Allowed; anything else
+//     gets Fallback
+type Policy struct {
+	Mode     string
+	Fallback string
+	Allowed  []string
+}
+
+func NewPolicy(mode, fallback string, allowed []string) Policy {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = PolicyVisitor
+	}
+	normalized := make([]string, 0, len(allowed))
+	for _, code := range allowed {
+		if code = Normalize(code); code != "" {
+			normalized = append(normalized, code)
+		}
+	}
+	return Policy{
+		Mode:     mode,
+		Fallback: Normalize(fallback),
+		Allowed:  normalized,
+	}
+}
+
+// Resolve returns the reply language for a message detected as detected from
+// a visitor whose browser prefers acceptLanguages. An empty result means no
+// constraint.
+func (p Policy) Resolve(detected string, acceptLanguages []string) string {
+	if p.Mode == PolicyFixed {
+		return p.Fallback
+	}
+
+	candidates := make([]string, 0, len(acceptLanguages)+1)
+	if detected = Normalize(detected); detected != "" {
+		candidates = append(candidates, detected)
+	}
+	candidates = append(candidates, acceptLanguages...)
+
+	for _, code := range candidates {
+		if p.Mode != PolicyWhitelist || p.allows(code) {
+			return code
+		}
+	}
+	return p.Fallback
+}
+
+func (p Policy) allows(code string) bool {
+	for _, allowed := range p.Allowed {
+		if allowed == code {
+			return true
+		}
+	}
+	return false
+}
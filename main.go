@@ -7,6 +7,7 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"talk-to-ugur-back/eval"
 	"talk-to-ugur-back/web"
 )
 
@@ -16,6 +17,12 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		code := eval.Main(ctx, os.Args[2:], os.Stdout, os.Stderr)
+		cancel()
+		os.Exit(code)
+	}
+
 	server, err := web.NewServer(ctx)
 	if err != nil {
 		panic(err)
@@ -11,18 +11,84 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const activateMessagePath = `-- name: ActivateMessagePath :exec
+WITH RECURSIVE path AS (
+  SELECT uuid, parent_uuid FROM chat_messages
+  WHERE uuid = $1::uuid AND thread_uuid = $2::uuid
+  UNION ALL
+  SELECT m.uuid, m.parent_uuid FROM chat_messages m
+  JOIN path p ON m.uuid = p.parent_uuid
+)
+UPDATE chat_messages c
+SET is_active = c.uuid IN (SELECT uuid FROM path)
+WHERE c.thread_uuid = $2::uuid
+  AND EXISTS (
+    SELECT 1 FROM path p
+    WHERE p.parent_uuid IS NOT DISTINCT FROM c.parent_uuid
+  )
+`
+
+type ActivateMessagePathParams struct {
+	ActiveUuid pgtype.UUID
+	ThreadUuid pgtype.UUID
+}
+
+func (q *Queries) ActivateMessagePath(ctx context.Context, arg ActivateMessagePathParams) error {
+	_, err := q.db.Exec(ctx, activateMessagePath, arg.ActiveUuid, arg.ThreadUuid)
+	return err
+}
+
+const countSiblings = `-- name: CountSiblings :many
+SELECT parent_uuid, count(*) AS siblings
+FROM chat_messages
+WHERE thread_uuid = $1
+GROUP BY parent_uuid
+`
+
+type CountSiblingsRow struct {
+	ParentUuid pgtype.UUID
+	Siblings   int64
+}
+
+func (q *Queries) CountSiblings(ctx context.Context, threadUuid pgtype.UUID) ([]CountSiblingsRow, error) {
+	rows, err := q.db.Query(ctx, countSiblings, threadUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountSiblingsRow
+	for rows.Next() {
+		var i CountSiblingsRow
+		if err := rows.Scan(&i.ParentUuid, &i.Siblings); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChatMessage = `-- name: CreateChatMessage :one
-INSERT INTO chat_messages (uuid, thread_uuid, role, content, emotion)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING uuid, thread_uuid, role, content, emotion, created_at
+INSERT INTO chat_messages (uuid, thread_uuid, role, content, emotion, language, parent_uuid, segments, model, prompt_version, author, language_mismatch)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+RETURNING uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch
 `
 
 type CreateChatMessageParams struct {
-	Uuid       pgtype.UUID
-	ThreadUuid pgtype.UUID
-	Role       string
-	Content    string
-	Emotion    pgtype.Text
+	Uuid             pgtype.UUID
+	ThreadUuid       pgtype.UUID
+	Role             string
+	Content          string
+	Emotion          pgtype.Text
+	Language         pgtype.Text
+	ParentUuid       pgtype.UUID
+	Segments         []byte
+	Model            pgtype.Text
+	PromptVersion    pgtype.Text
+	Author           pgtype.Text
+	LanguageMismatch bool
 }
 
 func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessageParams) (ChatMessage, error) {
@@ -32,6 +98,13 @@ func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessagePa
 		arg.Role,
 		arg.Content,
 		arg.Emotion,
+		arg.Language,
+		arg.ParentUuid,
+		arg.Segments,
+		arg.Model,
+		arg.PromptVersion,
+		arg.Author,
+		arg.LanguageMismatch,
 	)
 	var i ChatMessage
 	err := row.Scan(
@@ -41,6 +114,16 @@ func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessagePa
 		&i.Content,
 		&i.Emotion,
 		&i.CreatedAt,
+		&i.Language,
+		&i.ParentUuid,
+		&i.IsActive,
+		&i.Segments,
+		&i.Status,
+		&i.SearchVector,
+		&i.Model,
+		&i.PromptVersion,
+		&i.Author,
+		&i.LanguageMismatch,
 	)
 	return i, err
 }
@@ -48,7 +131,7 @@ func (q *Queries) CreateChatMessage(ctx context.Context, arg CreateChatMessagePa
 const createChatThread = `-- name: CreateChatThread :one
 INSERT INTO chat_threads (uuid, visitor_uuid)
 VALUES ($1, $2)
-RETURNING uuid, created_at, visitor_uuid
+RETURNING uuid, created_at, visitor_uuid, title, archived_at, last_activity_at, tags, labeled_at, flagged_at, flag_reason, taken_over_at
 `
 
 type CreateChatThreadParams struct {
@@ -59,18 +142,37 @@ type CreateChatThreadParams struct {
 func (q *Queries) CreateChatThread(ctx context.Context, arg CreateChatThreadParams) (ChatThread, error) {
 	row := q.db.QueryRow(ctx, createChatThread, arg.Uuid, arg.VisitorUuid)
 	var i ChatThread
-	err := row.Scan(&i.Uuid, &i.CreatedAt, &i.VisitorUuid)
+	err := row.Scan(
+		&i.Uuid,
+		&i.CreatedAt,
+		&i.VisitorUuid,
+		&i.Title,
+		&i.ArchivedAt,
+		&i.LastActivityAt,
+		&i.Tags,
+		&i.LabeledAt,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.TakenOverAt,
+	)
 	return i, err
 }
 
-const getChatMessagesByThread = `-- name: GetChatMessagesByThread :many
-SELECT uuid, thread_uuid, role, content, emotion, created_at FROM chat_messages
-WHERE thread_uuid = $1
+const getActiveBranch = `-- name: GetActiveBranch :many
+WITH RECURSIVE branch AS (
+  SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+  WHERE thread_uuid = $1 AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.uuid, m.thread_uuid, m.role, m.content, m.emotion, m.created_at, m.language, m.parent_uuid, m.is_active, m.segments, m.status, m.search_vector, m.model, m.prompt_version, m.author, m.language_mismatch FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM branch
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChatMessagesByThread(ctx context.Context, threadUuid pgtype.UUID) ([]ChatMessage, error) {
-	rows, err := q.db.Query(ctx, getChatMessagesByThread, threadUuid)
+func (q *Queries) GetActiveBranch(ctx context.Context, threadUuid pgtype.UUID) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getActiveBranch, threadUuid)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +187,16 @@ func (q *Queries) GetChatMessagesByThread(ctx context.Context, threadUuid pgtype
 			&i.Content,
 			&i.Emotion,
 			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
 		); err != nil {
 			return nil, err
 		}
@@ -96,20 +208,156 @@ func (q *Queries) GetChatMessagesByThread(ctx context.Context, threadUuid pgtype
 	return items, nil
 }
 
-const getChatMessagesByThreadLimit = `-- name: GetChatMessagesByThreadLimit :many
-SELECT uuid, thread_uuid, role, content, emotion, created_at FROM chat_messages
-WHERE thread_uuid = $1
+const getActiveBranchAfter = `-- name: GetActiveBranchAfter :many
+WITH RECURSIVE branch AS (
+  SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+  WHERE thread_uuid = $1::uuid AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.uuid, m.thread_uuid, m.role, m.content, m.emotion, m.created_at, m.language, m.parent_uuid, m.is_active, m.segments, m.status, m.search_vector, m.model, m.prompt_version, m.author, m.language_mismatch FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM branch
+WHERE (created_at, uuid) > ($2::timestamptz, $3::uuid)
+ORDER BY created_at ASC, uuid ASC
+LIMIT $4::int
+`
+
+type GetActiveBranchAfterParams struct {
+	ThreadUuid pgtype.UUID
+	CursorTime pgtype.Timestamptz
+	CursorUuid pgtype.UUID
+	PageSize   int32
+}
+
+func (q *Queries) GetActiveBranchAfter(ctx context.Context, arg GetActiveBranchAfterParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getActiveBranchAfter,
+		arg.ThreadUuid,
+		arg.CursorTime,
+		arg.CursorUuid,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.ThreadUuid,
+			&i.Role,
+			&i.Content,
+			&i.Emotion,
+			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getActiveBranchBefore = `-- name: GetActiveBranchBefore :many
+WITH RECURSIVE branch AS (
+  SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+  WHERE thread_uuid = $1::uuid AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.uuid, m.thread_uuid, m.role, m.content, m.emotion, m.created_at, m.language, m.parent_uuid, m.is_active, m.segments, m.status, m.search_vector, m.model, m.prompt_version, m.author, m.language_mismatch FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM branch
+WHERE $3::timestamptz IS NULL
+  OR (created_at, uuid) < ($3::timestamptz, $4::uuid)
+ORDER BY created_at DESC, uuid DESC
+LIMIT $2::int
+`
+
+type GetActiveBranchBeforeParams struct {
+	ThreadUuid pgtype.UUID
+	PageSize   int32
+	CursorTime pgtype.Timestamptz
+	CursorUuid pgtype.UUID
+}
+
+func (q *Queries) GetActiveBranchBefore(ctx context.Context, arg GetActiveBranchBeforeParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getActiveBranchBefore,
+		arg.ThreadUuid,
+		arg.PageSize,
+		arg.CursorTime,
+		arg.CursorUuid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.ThreadUuid,
+			&i.Role,
+			&i.Content,
+			&i.Emotion,
+			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getActiveBranchLimit = `-- name: GetActiveBranchLimit :many
+WITH RECURSIVE branch AS (
+  SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+  WHERE thread_uuid = $1 AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.uuid, m.thread_uuid, m.role, m.content, m.emotion, m.created_at, m.language, m.parent_uuid, m.is_active, m.segments, m.status, m.search_vector, m.model, m.prompt_version, m.author, m.language_mismatch FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM branch
 ORDER BY created_at DESC
 LIMIT $2
 `
 
-type GetChatMessagesByThreadLimitParams struct {
+type GetActiveBranchLimitParams struct {
 	ThreadUuid pgtype.UUID
 	Limit      int32
 }
 
-func (q *Queries) GetChatMessagesByThreadLimit(ctx context.Context, arg GetChatMessagesByThreadLimitParams) ([]ChatMessage, error) {
-	rows, err := q.db.Query(ctx, getChatMessagesByThreadLimit, arg.ThreadUuid, arg.Limit)
+func (q *Queries) GetActiveBranchLimit(ctx context.Context, arg GetActiveBranchLimitParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getActiveBranchLimit, arg.ThreadUuid, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +372,88 @@ func (q *Queries) GetChatMessagesByThreadLimit(ctx context.Context, arg GetChatM
 			&i.Content,
 			&i.Emotion,
 			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChatMessage = `-- name: GetChatMessage :one
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+WHERE uuid = $1
+`
+
+func (q *Queries) GetChatMessage(ctx context.Context, uuid pgtype.UUID) (ChatMessage, error) {
+	row := q.db.QueryRow(ctx, getChatMessage, uuid)
+	var i ChatMessage
+	err := row.Scan(
+		&i.Uuid,
+		&i.ThreadUuid,
+		&i.Role,
+		&i.Content,
+		&i.Emotion,
+		&i.CreatedAt,
+		&i.Language,
+		&i.ParentUuid,
+		&i.IsActive,
+		&i.Segments,
+		&i.Status,
+		&i.SearchVector,
+		&i.Model,
+		&i.PromptVersion,
+		&i.Author,
+		&i.LanguageMismatch,
+	)
+	return i, err
+}
+
+const getChatMessagesByThread = `-- name: GetChatMessagesByThread :many
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+WHERE thread_uuid = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChatMessagesByThread(ctx context.Context, threadUuid pgtype.UUID) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getChatMessagesByThread, threadUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.ThreadUuid,
+			&i.Role,
+			&i.Content,
+			&i.Emotion,
+			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
 		); err != nil {
 			return nil, err
 		}
@@ -136,13 +466,174 @@ func (q *Queries) GetChatMessagesByThreadLimit(ctx context.Context, arg GetChatM
 }
 
 const getChatThread = `-- name: GetChatThread :one
-SELECT uuid, created_at, visitor_uuid FROM chat_threads
+SELECT uuid, created_at, visitor_uuid, title, archived_at, last_activity_at, tags, labeled_at, flagged_at, flag_reason, taken_over_at FROM chat_threads
 WHERE uuid = $1
 `
 
 func (q *Queries) GetChatThread(ctx context.Context, uuid pgtype.UUID) (ChatThread, error) {
 	row := q.db.QueryRow(ctx, getChatThread, uuid)
 	var i ChatThread
-	err := row.Scan(&i.Uuid, &i.CreatedAt, &i.VisitorUuid)
+	err := row.Scan(
+		&i.Uuid,
+		&i.CreatedAt,
+		&i.VisitorUuid,
+		&i.Title,
+		&i.ArchivedAt,
+		&i.LastActivityAt,
+		&i.Tags,
+		&i.LabeledAt,
+		&i.FlaggedAt,
+		&i.FlagReason,
+		&i.TakenOverAt,
+	)
 	return i, err
 }
+
+const getMessagePath = `-- name: GetMessagePath :many
+WITH RECURSIVE path AS (
+  SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+  WHERE uuid = $1
+  UNION ALL
+  SELECT m.uuid, m.thread_uuid, m.role, m.content, m.emotion, m.created_at, m.language, m.parent_uuid, m.is_active, m.segments, m.status, m.search_vector, m.model, m.prompt_version, m.author, m.language_mismatch FROM chat_messages m
+  JOIN path p ON m.uuid = p.parent_uuid
+)
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM path
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetMessagePathParams struct {
+	Uuid  pgtype.UUID
+	Limit int32
+}
+
+func (q *Queries) GetMessagePath(ctx context.Context, arg GetMessagePathParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getMessagePath, arg.Uuid, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.ThreadUuid,
+			&i.Role,
+			&i.Content,
+			&i.Emotion,
+			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageSiblings = `-- name: GetMessageSiblings :many
+SELECT uuid, thread_uuid, role, content, emotion, created_at, language, parent_uuid, is_active, segments, status, search_vector, model, prompt_version, author, language_mismatch FROM chat_messages
+WHERE thread_uuid = $1::uuid
+  AND parent_uuid IS NOT DISTINCT FROM $2::uuid
+ORDER BY created_at ASC
+`
+
+type GetMessageSiblingsParams struct {
+	ThreadUuid pgtype.UUID
+	ParentUuid pgtype.UUID
+}
+
+func (q *Queries) GetMessageSiblings(ctx context.Context, arg GetMessageSiblingsParams) ([]ChatMessage, error) {
+	rows, err := q.db.Query(ctx, getMessageSiblings, arg.ThreadUuid, arg.ParentUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMessage
+	for rows.Next() {
+		var i ChatMessage
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.ThreadUuid,
+			&i.Role,
+			&i.Content,
+			&i.Emotion,
+			&i.CreatedAt,
+			&i.Language,
+			&i.ParentUuid,
+			&i.IsActive,
+			&i.Segments,
+			&i.Status,
+			&i.SearchVector,
+			&i.Model,
+			&i.PromptVersion,
+			&i.Author,
+			&i.LanguageMismatch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markChatMessageFailed = `-- name: MarkChatMessageFailed :exec
+UPDATE chat_messages
+SET status = 'failed'
+WHERE uuid = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM chat_messages r
+    WHERE r.parent_uuid = $1
+  )
+`
+
+func (q *Queries) MarkChatMessageFailed(ctx context.Context, uuid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markChatMessageFailed, uuid)
+	return err
+}
+
+const markChatMessageSent = `-- name: MarkChatMessageSent :exec
+UPDATE chat_messages
+SET status = 'sent'
+WHERE uuid = $1
+  AND status = 'failed'
+`
+
+func (q *Queries) MarkChatMessageSent(ctx context.Context, uuid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markChatMessageSent, uuid)
+	return err
+}
+
+const setActiveMessage = `-- name: SetActiveMessage :exec
+UPDATE chat_messages
+SET is_active = (uuid = $1::uuid)
+WHERE thread_uuid = $2::uuid
+  AND parent_uuid IS NOT DISTINCT FROM $3::uuid
+`
+
+type SetActiveMessageParams struct {
+	ActiveUuid pgtype.UUID
+	ThreadUuid pgtype.UUID
+	ParentUuid pgtype.UUID
+}
+
+func (q *Queries) SetActiveMessage(ctx context.Context, arg SetActiveMessageParams) error {
+	_, err := q.db.Exec(ctx, setActiveMessage, arg.ActiveUuid, arg.ThreadUuid, arg.ParentUuid)
+	return err
+}
@@ -8,19 +8,103 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ChatAttachment struct {
+	Uuid        pgtype.UUID
+	MessageUuid pgtype.UUID
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
+	Filename    pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+}
+
 type ChatMessage struct {
-	Uuid       pgtype.UUID
-	ThreadUuid pgtype.UUID
-	Role       string
-	Content    string
-	Emotion    pgtype.Text
-	CreatedAt  pgtype.Timestamptz
+	Uuid             pgtype.UUID
+	ThreadUuid       pgtype.UUID
+	Role             string
+	Content          string
+	Emotion          pgtype.Text
+	CreatedAt        pgtype.Timestamptz
+	Language         pgtype.Text
+	ParentUuid       pgtype.UUID
+	IsActive         bool
+	Segments         []byte
+	Status           string
+	SearchVector     interface{}
+	Model            pgtype.Text
+	PromptVersion    pgtype.Text
+	Author           pgtype.Text
+	LanguageMismatch bool
 }
 
-type ChatThread struct {
+type ChatMessageAudio struct {
 	Uuid        pgtype.UUID
+	MessageUuid pgtype.UUID
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
 	CreatedAt   pgtype.Timestamptz
+}
+
+type ChatMessageFeedback struct {
+	MessageUuid pgtype.UUID
 	VisitorUuid pgtype.UUID
+	Rating      string
+	Reason      pgtype.Text
+	Comment     pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+}
+
+type ChatPrompt struct {
+	Uuid             pgtype.UUID
+	MessageUuid      pgtype.UUID
+	Model            string
+	Temperature      float64
+	ResponseFormat   string
+	SystemPrompt     string
+	SystemPromptHash string
+	HistoryUuids     []pgtype.UUID
+	Request          []byte
+	CreatedAt        pgtype.Timestamptz
+}
+
+type ChatThread struct {
+	Uuid           pgtype.UUID
+	CreatedAt      pgtype.Timestamptz
+	VisitorUuid    pgtype.UUID
+	Title          pgtype.Text
+	ArchivedAt     pgtype.Timestamptz
+	LastActivityAt pgtype.Timestamptz
+	Tags           []string
+	LabeledAt      pgtype.Timestamptz
+	FlaggedAt      pgtype.Timestamptz
+	FlagReason     pgtype.Text
+	TakenOverAt    pgtype.Timestamptz
+}
+
+type Emotion struct {
+	Name        string
+	Description string
+	Triggers    []string
+	Weight      float64
+	Position    int32
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+}
+
+type IdempotencyKey struct {
+	VisitorUuid     pgtype.UUID
+	Key             string
+	RequestHash     string
+	Status          string
+	ResponseStatus  pgtype.Int4
+	ResponseHeaders []byte
+	ResponseBody    []byte
+	LockedUntil     pgtype.Timestamptz
+	ExpiresAt       pgtype.Timestamptz
+	CreatedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
 }
 
 type Visitor struct {
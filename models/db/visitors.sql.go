@@ -88,6 +88,87 @@ func (q *Queries) GetVisitor(ctx context.Context, uuid pgtype.UUID) (Visitor, er
 	return i, err
 }
 
+const listVisitors = `-- name: ListVisitors :many
+SELECT
+  v.uuid,
+  v.ip_address,
+  v.user_agent,
+  v.accept_language,
+  v.referer,
+  v.created_at,
+  v.last_seen_at,
+  (SELECT count(*) FROM chat_threads t WHERE t.visitor_uuid = v.uuid) AS thread_count
+FROM visitors v
+WHERE ($2::timestamptz IS NULL OR v.last_seen_at >= $2::timestamptz)
+  AND ($3::timestamptz IS NULL OR v.last_seen_at < $3::timestamptz)
+  AND ($4::text IS NULL OR v.ip_address = $4::text)
+  AND ($5::text IS NULL OR v.user_agent ILIKE '%' || $5::text || '%')
+  AND (
+    $6::timestamptz IS NULL
+    OR (v.last_seen_at, v.uuid) < ($6::timestamptz, $7::uuid)
+  )
+ORDER BY v.last_seen_at DESC, v.uuid DESC
+LIMIT $1::int
+`
+
+type ListVisitorsParams struct {
+	PageSize   int32
+	SeenAfter  pgtype.Timestamptz
+	SeenBefore pgtype.Timestamptz
+	IpAddress  pgtype.Text
+	UserAgent  pgtype.Text
+	CursorSeen pgtype.Timestamptz
+	CursorUuid pgtype.UUID
+}
+
+type ListVisitorsRow struct {
+	Uuid           pgtype.UUID
+	IpAddress      string
+	UserAgent      pgtype.Text
+	AcceptLanguage pgtype.Text
+	Referer        pgtype.Text
+	CreatedAt      pgtype.Timestamptz
+	LastSeenAt     pgtype.Timestamptz
+	ThreadCount    int64
+}
+
+func (q *Queries) ListVisitors(ctx context.Context, arg ListVisitorsParams) ([]ListVisitorsRow, error) {
+	rows, err := q.db.Query(ctx, listVisitors,
+		arg.PageSize,
+		arg.SeenAfter,
+		arg.SeenBefore,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.CursorSeen,
+		arg.CursorUuid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListVisitorsRow
+	for rows.Next() {
+		var i ListVisitorsRow
+		if err := rows.Scan(
+			&i.Uuid,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.AcceptLanguage,
+			&i.Referer,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.ThreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateVisitorLastSeen = `-- name: UpdateVisitorLastSeen :one
 UPDATE visitors
 SET
@@ -0,0 +1,12 @@
+CREATE TABLE chat_attachments (
+  uuid UUID PRIMARY KEY,
+  message_uuid UUID NOT NULL REFERENCES chat_messages(uuid) ON DELETE CASCADE,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  filename TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX chat_attachments_message_uuid_idx
+  ON chat_attachments (message_uuid);
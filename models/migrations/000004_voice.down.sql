@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS chat_message_audio_message_uuid_idx;
+DROP TABLE IF EXISTS chat_message_audio;
@@ -0,0 +1,11 @@
+CREATE TABLE chat_message_audio (
+  uuid UUID PRIMARY KEY,
+  message_uuid UUID NOT NULL REFERENCES chat_messages(uuid) ON DELETE CASCADE,
+  storage_key TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX chat_message_audio_message_uuid_idx
+  ON chat_message_audio (message_uuid);
@@ -0,0 +1,5 @@
+DELETE FROM chat_messages WHERE NOT is_active;
+DROP INDEX IF EXISTS chat_messages_reply_to_uuid_idx;
+ALTER TABLE chat_messages
+  DROP COLUMN IF EXISTS is_active,
+  DROP COLUMN IF EXISTS reply_to_uuid;
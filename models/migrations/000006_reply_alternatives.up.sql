@@ -0,0 +1,17 @@
+ALTER TABLE chat_messages
+  ADD COLUMN reply_to_uuid UUID REFERENCES chat_messages(uuid) ON DELETE CASCADE,
+  ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT true;
+
+UPDATE chat_messages AS a
+SET reply_to_uuid = (
+  SELECT u.uuid FROM chat_messages AS u
+  WHERE u.thread_uuid = a.thread_uuid
+    AND u.role = 'user'
+    AND u.created_at <= a.created_at
+  ORDER BY u.created_at DESC
+  LIMIT 1
+)
+WHERE a.role = 'assistant';
+
+CREATE INDEX chat_messages_reply_to_uuid_idx
+  ON chat_messages (reply_to_uuid);
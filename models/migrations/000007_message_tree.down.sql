@@ -0,0 +1,3 @@
+UPDATE chat_messages SET parent_uuid = NULL WHERE role = 'user';
+ALTER INDEX chat_messages_parent_uuid_idx RENAME TO chat_messages_reply_to_uuid_idx;
+ALTER TABLE chat_messages RENAME COLUMN parent_uuid TO reply_to_uuid;
@@ -0,0 +1,15 @@
+ALTER TABLE chat_messages RENAME COLUMN reply_to_uuid TO parent_uuid;
+ALTER INDEX chat_messages_reply_to_uuid_idx RENAME TO chat_messages_parent_uuid_idx;
+
+-- Until now user messages were chained implicitly by created_at. Attach each
+-- one to the active message that preceded it so every thread becomes a tree.
+UPDATE chat_messages AS u
+SET parent_uuid = (
+  SELECT p.uuid FROM chat_messages AS p
+  WHERE p.thread_uuid = u.thread_uuid
+    AND p.is_active
+    AND p.created_at < u.created_at
+  ORDER BY p.created_at DESC
+  LIMIT 1
+)
+WHERE u.role = 'user';
@@ -0,0 +1,15 @@
+CREATE TABLE chat_prompts (
+  uuid UUID PRIMARY KEY,
+  message_uuid UUID NOT NULL UNIQUE REFERENCES chat_messages(uuid) ON DELETE CASCADE,
+  model TEXT NOT NULL,
+  temperature DOUBLE PRECISION NOT NULL,
+  response_format TEXT NOT NULL,
+  system_prompt TEXT NOT NULL,
+  system_prompt_hash TEXT NOT NULL,
+  history_uuids UUID[] NOT NULL,
+  request JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX chat_prompts_created_at_idx
+  ON chat_prompts (created_at);
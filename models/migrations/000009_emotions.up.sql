@@ -0,0 +1,9 @@
+CREATE TABLE emotions (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT '',
+  triggers TEXT[] NOT NULL DEFAULT '{}',
+  weight DOUBLE PRECISION NOT NULL DEFAULT 1,
+  position INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,17 @@
+CREATE TABLE idempotency_keys (
+  visitor_uuid UUID NOT NULL REFERENCES visitors(uuid) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'in_progress',
+  response_status INTEGER,
+  response_headers JSONB,
+  response_body BYTEA,
+  locked_until TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (visitor_uuid, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx
+  ON idempotency_keys (expires_at);
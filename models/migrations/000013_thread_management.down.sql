@@ -0,0 +1,9 @@
+CREATE INDEX chat_threads_visitor_uuid_idx
+  ON chat_threads (visitor_uuid);
+
+DROP INDEX IF EXISTS chat_threads_visitor_activity_idx;
+
+ALTER TABLE chat_threads
+  DROP COLUMN IF EXISTS last_activity_at,
+  DROP COLUMN IF EXISTS archived_at,
+  DROP COLUMN IF EXISTS title;
@@ -0,0 +1,17 @@
+ALTER TABLE chat_threads
+  ADD COLUMN title TEXT,
+  ADD COLUMN archived_at TIMESTAMPTZ,
+  ADD COLUMN last_activity_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE chat_threads t
+SET last_activity_at = COALESCE(
+  (SELECT max(m.created_at) FROM chat_messages m WHERE m.thread_uuid = t.uuid),
+  t.created_at
+);
+
+-- Serves the visitor's thread list ordered by activity; replaces the plain
+-- visitor index, whose lookups it covers as well.
+CREATE INDEX chat_threads_visitor_activity_idx
+  ON chat_threads (visitor_uuid, last_activity_at DESC, uuid DESC);
+
+DROP INDEX IF EXISTS chat_threads_visitor_uuid_idx;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS chat_threads_tags_idx;
+
+ALTER TABLE chat_threads
+  DROP COLUMN IF EXISTS labeled_at,
+  DROP COLUMN IF EXISTS tags;
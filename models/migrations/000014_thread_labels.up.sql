@@ -0,0 +1,6 @@
+ALTER TABLE chat_threads
+  ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN labeled_at TIMESTAMPTZ;
+
+CREATE INDEX chat_threads_tags_idx
+  ON chat_threads USING GIN (tags);
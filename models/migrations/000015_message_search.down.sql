@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS chat_messages_search_idx;
+
+ALTER TABLE chat_messages
+  DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS chat_search_config(TEXT);
@@ -0,0 +1,32 @@
+-- Maps the language codes detected for messages to text search
+-- configurations; languages without one fall back to simple. The
+-- configurations are schema-qualified constants, so the generated column
+-- does not depend on the search_path of the session writing the row.
+CREATE OR REPLACE FUNCTION chat_search_config(language TEXT) RETURNS regconfig
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+  SELECT CASE language
+    WHEN 'ar' THEN 'pg_catalog.arabic'::regconfig
+    WHEN 'de' THEN 'pg_catalog.german'::regconfig
+    WHEN 'el' THEN 'pg_catalog.greek'::regconfig
+    WHEN 'en' THEN 'pg_catalog.english'::regconfig
+    WHEN 'es' THEN 'pg_catalog.spanish'::regconfig
+    WHEN 'fr' THEN 'pg_catalog.french'::regconfig
+    WHEN 'hi' THEN 'pg_catalog.hindi'::regconfig
+    WHEN 'it' THEN 'pg_catalog.italian'::regconfig
+    WHEN 'nl' THEN 'pg_catalog.dutch'::regconfig
+    WHEN 'pt' THEN 'pg_catalog.portuguese'::regconfig
+    WHEN 'ru' THEN 'pg_catalog.russian'::regconfig
+    WHEN 'tr' THEN 'pg_catalog.turkish'::regconfig
+    ELSE 'pg_catalog.simple'::regconfig
+  END
+$$;
+
+-- Stemmed words in the message's language plus the words as written, so a
+-- query matches either way whatever language it is in.
+ALTER TABLE chat_messages
+  ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector(chat_search_config(language), content) || to_tsvector('pg_catalog.simple'::regconfig, content)
+  ) STORED;
+
+CREATE INDEX chat_messages_search_idx
+  ON chat_messages USING GIN (search_vector);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS chat_message_feedback;
+
+ALTER TABLE chat_messages
+  DROP COLUMN IF EXISTS prompt_version,
+  DROP COLUMN IF EXISTS model;
@@ -0,0 +1,17 @@
+ALTER TABLE chat_messages
+  ADD COLUMN model TEXT,
+  ADD COLUMN prompt_version TEXT;
+
+CREATE TABLE chat_message_feedback (
+  message_uuid UUID NOT NULL REFERENCES chat_messages(uuid) ON DELETE CASCADE,
+  visitor_uuid UUID NOT NULL REFERENCES visitors(uuid) ON DELETE CASCADE,
+  rating TEXT NOT NULL CHECK (rating IN ('up', 'down')),
+  reason TEXT,
+  comment TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (message_uuid, visitor_uuid)
+);
+
+CREATE INDEX chat_message_feedback_created_at_idx
+  ON chat_message_feedback (created_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS visitors_last_seen_idx;
+DROP INDEX IF EXISTS chat_threads_activity_idx;
+DROP INDEX IF EXISTS chat_threads_flagged_idx;
+
+ALTER TABLE chat_threads
+  DROP COLUMN IF EXISTS flag_reason,
+  DROP COLUMN IF EXISTS flagged_at;
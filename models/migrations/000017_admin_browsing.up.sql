@@ -0,0 +1,13 @@
+ALTER TABLE chat_threads
+  ADD COLUMN flagged_at TIMESTAMPTZ,
+  ADD COLUMN flag_reason TEXT;
+
+CREATE INDEX chat_threads_flagged_idx
+  ON chat_threads (flagged_at DESC)
+  WHERE flagged_at IS NOT NULL;
+
+CREATE INDEX chat_threads_activity_idx
+  ON chat_threads (last_activity_at DESC, uuid DESC);
+
+CREATE INDEX visitors_last_seen_idx
+  ON visitors (last_seen_at DESC, uuid DESC);
@@ -0,0 +1,5 @@
+ALTER TABLE chat_messages
+  DROP COLUMN IF EXISTS author;
+
+ALTER TABLE chat_threads
+  DROP COLUMN IF EXISTS taken_over_at;
@@ -0,0 +1,5 @@
+ALTER TABLE chat_threads
+  ADD COLUMN taken_over_at TIMESTAMPTZ;
+
+ALTER TABLE chat_messages
+  ADD COLUMN author TEXT CHECK (author IN ('ai', 'human'));
@@ -0,0 +1,2 @@
+ALTER TABLE chat_messages
+  ADD COLUMN language_mismatch BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,27 @@
+-- name: CreateChatAttachment :one
+INSERT INTO chat_attachments (
+  uuid,
+  message_uuid,
+  storage_key,
+  content_type,
+  size_bytes,
+  filename
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetChatAttachment :one
+SELECT * FROM chat_attachments
+WHERE uuid = $1;
+
+-- name: GetChatAttachmentsByMessages :many
+SELECT * FROM chat_attachments
+WHERE message_uuid = ANY(@message_uuids::uuid[])
+ORDER BY created_at ASC;
+
+-- name: CopyChatAttachments :exec
+INSERT INTO chat_attachments (uuid, message_uuid, storage_key, content_type, size_bytes, filename)
+SELECT gen_random_uuid(), @to_message_uuid::uuid, storage_key, content_type, size_bytes, filename
+FROM chat_attachments
+WHERE message_uuid = @from_message_uuid::uuid;
@@ -0,0 +1,20 @@
+-- name: CreateChatMessageAudio :one
+INSERT INTO chat_message_audio (
+  uuid,
+  message_uuid,
+  storage_key,
+  content_type,
+  size_bytes
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetChatMessageAudio :one
+SELECT * FROM chat_message_audio
+WHERE uuid = $1;
+
+-- name: GetChatMessageAudioByMessages :many
+SELECT * FROM chat_message_audio
+WHERE message_uuid = ANY(@message_uuids::uuid[])
+ORDER BY created_at ASC;
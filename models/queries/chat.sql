@@ -8,17 +8,130 @@ SELECT * FROM chat_threads
 WHERE uuid = $1;
 
 -- name: CreateChatMessage :one
-INSERT INTO chat_messages (uuid, thread_uuid, role, content, emotion)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO chat_messages (uuid, thread_uuid, role, content, emotion, language, parent_uuid, segments, model, prompt_version, author, language_mismatch)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 RETURNING *;
 
+-- name: GetChatMessage :one
+SELECT * FROM chat_messages
+WHERE uuid = $1;
+
 -- name: GetChatMessagesByThread :many
 SELECT * FROM chat_messages
 WHERE thread_uuid = $1
 ORDER BY created_at ASC;
 
--- name: GetChatMessagesByThreadLimit :many
-SELECT * FROM chat_messages
-WHERE thread_uuid = $1
+-- name: GetActiveBranch :many
+WITH RECURSIVE branch AS (
+  SELECT * FROM chat_messages
+  WHERE thread_uuid = $1 AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.* FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT * FROM branch
+ORDER BY created_at ASC;
+
+-- name: GetActiveBranchLimit :many
+WITH RECURSIVE branch AS (
+  SELECT * FROM chat_messages
+  WHERE thread_uuid = $1 AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.* FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT * FROM branch
 ORDER BY created_at DESC
 LIMIT $2;
+
+-- name: GetMessagePath :many
+WITH RECURSIVE path AS (
+  SELECT * FROM chat_messages
+  WHERE uuid = $1
+  UNION ALL
+  SELECT m.* FROM chat_messages m
+  JOIN path p ON m.uuid = p.parent_uuid
+)
+SELECT * FROM path
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetMessageSiblings :many
+SELECT * FROM chat_messages
+WHERE thread_uuid = @thread_uuid::uuid
+  AND parent_uuid IS NOT DISTINCT FROM sqlc.narg(parent_uuid)::uuid
+ORDER BY created_at ASC;
+
+-- name: SetActiveMessage :exec
+UPDATE chat_messages
+SET is_active = (uuid = @active_uuid::uuid)
+WHERE thread_uuid = @thread_uuid::uuid
+  AND parent_uuid IS NOT DISTINCT FROM sqlc.narg(parent_uuid)::uuid;
+
+-- name: ActivateMessagePath :exec
+WITH RECURSIVE path AS (
+  SELECT uuid, parent_uuid FROM chat_messages
+  WHERE uuid = @active_uuid::uuid AND thread_uuid = @thread_uuid::uuid
+  UNION ALL
+  SELECT m.uuid, m.parent_uuid FROM chat_messages m
+  JOIN path p ON m.uuid = p.parent_uuid
+)
+UPDATE chat_messages c
+SET is_active = c.uuid IN (SELECT uuid FROM path)
+WHERE c.thread_uuid = @thread_uuid::uuid
+  AND EXISTS (
+    SELECT 1 FROM path p
+    WHERE p.parent_uuid IS NOT DISTINCT FROM c.parent_uuid
+  );
+
+-- name: CountSiblings :many
+SELECT parent_uuid, count(*) AS siblings
+FROM chat_messages
+WHERE thread_uuid = $1
+GROUP BY parent_uuid;
+
+-- name: MarkChatMessageFailed :exec
+UPDATE chat_messages
+SET status = 'failed'
+WHERE uuid = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM chat_messages r
+    WHERE r.parent_uuid = $1
+  );
+
+-- name: MarkChatMessageSent :exec
+UPDATE chat_messages
+SET status = 'sent'
+WHERE uuid = $1
+  AND status = 'failed';
+
+-- name: GetActiveBranchBefore :many
+WITH RECURSIVE branch AS (
+  SELECT * FROM chat_messages
+  WHERE thread_uuid = @thread_uuid::uuid AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.* FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT * FROM branch
+WHERE sqlc.narg(cursor_time)::timestamptz IS NULL
+  OR (created_at, uuid) < (sqlc.narg(cursor_time)::timestamptz, sqlc.narg(cursor_uuid)::uuid)
+ORDER BY created_at DESC, uuid DESC
+LIMIT @page_size::int;
+
+-- name: GetActiveBranchAfter :many
+WITH RECURSIVE branch AS (
+  SELECT * FROM chat_messages
+  WHERE thread_uuid = @thread_uuid::uuid AND parent_uuid IS NULL AND is_active
+  UNION ALL
+  SELECT m.* FROM chat_messages m
+  JOIN branch b ON m.parent_uuid = b.uuid
+  WHERE m.is_active
+)
+SELECT * FROM branch
+WHERE (created_at, uuid) > (@cursor_time::timestamptz, @cursor_uuid::uuid)
+ORDER BY created_at ASC, uuid ASC
+LIMIT @page_size::int;
@@ -0,0 +1,25 @@
+-- name: ListEmotions :many
+SELECT * FROM emotions
+ORDER BY position, name;
+
+-- name: UpsertEmotion :one
+INSERT INTO emotions (
+  name,
+  description,
+  triggers,
+  weight,
+  position
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+ON CONFLICT (name) DO UPDATE SET
+  description = EXCLUDED.description,
+  triggers = EXCLUDED.triggers,
+  weight = EXCLUDED.weight,
+  position = EXCLUDED.position,
+  updated_at = now()
+RETURNING *;
+
+-- name: DeleteEmotion :execrows
+DELETE FROM emotions
+WHERE name = $1;
@@ -0,0 +1,48 @@
+-- name: UpsertMessageFeedback :one
+INSERT INTO chat_message_feedback (message_uuid, visitor_uuid, rating, reason, comment)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (message_uuid, visitor_uuid) DO UPDATE
+SET rating = EXCLUDED.rating,
+    reason = EXCLUDED.reason,
+    comment = EXCLUDED.comment,
+    updated_at = now()
+RETURNING *;
+
+-- name: DeleteMessageFeedback :execrows
+DELETE FROM chat_message_feedback
+WHERE message_uuid = $1 AND visitor_uuid = $2;
+
+-- name: FeedbackStats :many
+SELECT
+  CASE @group_by::text
+    WHEN 'model' THEN COALESCE(m.model, '')
+    WHEN 'emotion' THEN COALESCE(m.emotion, '')
+    ELSE COALESCE(m.prompt_version, '')
+  END AS group_key,
+  CASE WHEN @bucket::text = '' THEN NULL ELSE date_trunc(@bucket::text, f.created_at) END::timestamptz AS bucket,
+  count(*) FILTER (WHERE f.rating = 'up') AS up,
+  count(*) FILTER (WHERE f.rating = 'down') AS down,
+  count(*) FILTER (WHERE f.comment IS NOT NULL) AS comments
+FROM chat_message_feedback f
+JOIN chat_messages m ON m.uuid = f.message_uuid
+WHERE (sqlc.narg(created_from)::timestamptz IS NULL OR f.created_at >= sqlc.narg(created_from)::timestamptz)
+  AND (sqlc.narg(created_to)::timestamptz IS NULL OR f.created_at < sqlc.narg(created_to)::timestamptz)
+GROUP BY 1, 2
+ORDER BY 2 DESC NULLS FIRST, 1;
+
+-- name: FeedbackReasonStats :many
+SELECT
+  CASE @group_by::text
+    WHEN 'model' THEN COALESCE(m.model, '')
+    WHEN 'emotion' THEN COALESCE(m.emotion, '')
+    ELSE COALESCE(m.prompt_version, '')
+  END AS group_key,
+  f.reason,
+  count(*) AS count
+FROM chat_message_feedback f
+JOIN chat_messages m ON m.uuid = f.message_uuid
+WHERE f.reason IS NOT NULL
+  AND (sqlc.narg(created_from)::timestamptz IS NULL OR f.created_at >= sqlc.narg(created_from)::timestamptz)
+  AND (sqlc.narg(created_to)::timestamptz IS NULL OR f.created_at < sqlc.narg(created_to)::timestamptz)
+GROUP BY 1, 2
+ORDER BY 1, 3 DESC;
@@ -0,0 +1,44 @@
+-- name: ClaimIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  visitor_uuid,
+  key,
+  request_hash,
+  locked_until,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+ON CONFLICT (visitor_uuid, key) DO UPDATE SET
+  request_hash = EXCLUDED.request_hash,
+  status = 'in_progress',
+  response_status = NULL,
+  response_headers = NULL,
+  response_body = NULL,
+  locked_until = EXCLUDED.locked_until,
+  expires_at = EXCLUDED.expires_at,
+  created_at = now(),
+  updated_at = now()
+WHERE idempotency_keys.expires_at < now()
+  OR (idempotency_keys.status = 'in_progress' AND idempotency_keys.locked_until < now())
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE visitor_uuid = $1 AND key = $2;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET status = 'completed',
+    response_status = $3,
+    response_headers = $4,
+    response_body = $5,
+    updated_at = now()
+WHERE visitor_uuid = $1 AND key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE visitor_uuid = $1 AND key = $2;
+
+-- name: DeleteIdempotencyKeysBefore :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < $1;
@@ -0,0 +1,23 @@
+-- name: CreateChatPrompt :one
+INSERT INTO chat_prompts (
+  uuid,
+  message_uuid,
+  model,
+  temperature,
+  response_format,
+  system_prompt,
+  system_prompt_hash,
+  history_uuids,
+  request
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: GetChatPromptByMessage :one
+SELECT * FROM chat_prompts
+WHERE message_uuid = $1;
+
+-- name: DeleteChatPromptsBefore :execrows
+DELETE FROM chat_prompts
+WHERE created_at < $1;
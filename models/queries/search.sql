@@ -0,0 +1,32 @@
+-- name: SearchChatMessages :many
+SELECT
+  m.uuid,
+  m.thread_uuid,
+  t.visitor_uuid,
+  t.title AS thread_title,
+  m.role,
+  m.emotion,
+  m.language,
+  m.created_at,
+  ts_headline(
+    chat_search_config(m.language),
+    m.content,
+    q.query,
+    'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MaxWords=25, MinWords=8'
+  ) AS snippet,
+  ts_rank_cd(m.search_vector, q.query) AS rank
+FROM chat_messages m
+JOIN chat_threads t ON t.uuid = m.thread_uuid
+CROSS JOIN LATERAL (
+  SELECT websearch_to_tsquery(chat_search_config(@language::text), @query::text)
+    || websearch_to_tsquery('pg_catalog.simple'::regconfig, @query::text) AS query
+) q
+WHERE m.search_vector @@ q.query
+  AND (sqlc.narg(role)::text IS NULL OR m.role = sqlc.narg(role)::text)
+  AND (sqlc.narg(emotion)::text IS NULL OR m.emotion = sqlc.narg(emotion)::text)
+  AND (sqlc.narg(visitor_uuid)::uuid IS NULL OR t.visitor_uuid = sqlc.narg(visitor_uuid)::uuid)
+  AND (sqlc.narg(created_from)::timestamptz IS NULL OR m.created_at >= sqlc.narg(created_from)::timestamptz)
+  AND (sqlc.narg(created_to)::timestamptz IS NULL OR m.created_at < sqlc.narg(created_to)::timestamptz)
+ORDER BY rank DESC, m.created_at DESC, m.uuid DESC
+LIMIT @page_size::int
+OFFSET @page_offset::int;
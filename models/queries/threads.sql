@@ -0,0 +1,178 @@
+-- name: ListVisitorThreads :many
+SELECT
+  t.uuid,
+  t.title,
+  t.tags,
+  t.created_at,
+  t.last_activity_at,
+  t.archived_at,
+  COALESCE(last.message_count, 0)::bigint AS message_count,
+  last.role AS last_message_role,
+  last.content AS last_message_content
+FROM chat_threads t
+LEFT JOIN LATERAL (
+  WITH RECURSIVE branch AS (
+    SELECT m.uuid, m.role, m.content, 1 AS depth
+    FROM chat_messages m
+    WHERE m.thread_uuid = t.uuid AND m.parent_uuid IS NULL AND m.is_active
+    UNION ALL
+    SELECT m.uuid, m.role, m.content, b.depth + 1
+    FROM chat_messages m
+    JOIN branch b ON m.parent_uuid = b.uuid
+    WHERE m.is_active
+  )
+  SELECT b.role, b.content, (SELECT count(*) FROM branch) AS message_count
+  FROM branch b
+  ORDER BY b.depth DESC
+  LIMIT 1
+) last ON true
+WHERE t.visitor_uuid = @visitor_uuid::uuid
+  AND (t.archived_at IS NOT NULL) = @archived::boolean
+  AND (
+    sqlc.narg(cursor_activity)::timestamptz IS NULL
+    OR (t.last_activity_at, t.uuid) < (sqlc.narg(cursor_activity)::timestamptz, sqlc.narg(cursor_uuid)::uuid)
+  )
+ORDER BY t.last_activity_at DESC, t.uuid DESC
+LIMIT @page_size::int;
+
+-- name: GetThreadSummary :one
+SELECT
+  t.uuid,
+  t.title,
+  t.tags,
+  t.created_at,
+  t.last_activity_at,
+  t.archived_at,
+  COALESCE(last.message_count, 0)::bigint AS message_count,
+  last.role AS last_message_role,
+  last.content AS last_message_content
+FROM chat_threads t
+LEFT JOIN LATERAL (
+  WITH RECURSIVE branch AS (
+    SELECT m.uuid, m.role, m.content, 1 AS depth
+    FROM chat_messages m
+    WHERE m.thread_uuid = t.uuid AND m.parent_uuid IS NULL AND m.is_active
+    UNION ALL
+    SELECT m.uuid, m.role, m.content, b.depth + 1
+    FROM chat_messages m
+    JOIN branch b ON m.parent_uuid = b.uuid
+    WHERE m.is_active
+  )
+  SELECT b.role, b.content, (SELECT count(*) FROM branch) AS message_count
+  FROM branch b
+  ORDER BY b.depth DESC
+  LIMIT 1
+) last ON true
+WHERE t.uuid = @uuid::uuid;
+
+-- name: TouchChatThread :exec
+UPDATE chat_threads
+SET last_activity_at = now(),
+    archived_at = NULL
+WHERE uuid = $1;
+
+-- name: SetChatThreadTitle :exec
+UPDATE chat_threads
+SET title = $2
+WHERE uuid = $1;
+
+-- name: SetChatThreadArchived :exec
+UPDATE chat_threads
+SET archived_at = CASE WHEN @archived::boolean THEN COALESCE(archived_at, now()) END
+WHERE uuid = @uuid::uuid;
+
+-- name: ListThreadStorageKeys :many
+SELECT a.storage_key
+FROM chat_attachments a
+JOIN chat_messages m ON m.uuid = a.message_uuid
+WHERE m.thread_uuid = $1
+UNION
+SELECT au.storage_key
+FROM chat_message_audio au
+JOIN chat_messages m ON m.uuid = au.message_uuid
+WHERE m.thread_uuid = $1;
+
+-- name: DeleteChatThread :execrows
+DELETE FROM chat_threads
+WHERE uuid = $1;
+
+-- name: ClaimThreadLabels :execrows
+UPDATE chat_threads
+SET labeled_at = now()
+WHERE uuid = $1 AND labeled_at IS NULL;
+
+-- name: ReleaseThreadLabels :exec
+UPDATE chat_threads
+SET labeled_at = NULL
+WHERE uuid = $1;
+
+-- name: SetThreadLabels :exec
+UPDATE chat_threads
+SET title = CASE WHEN @replace_title::boolean THEN sqlc.narg(title)::text ELSE COALESCE(title, sqlc.narg(title)::text) END,
+    tags = @tags::text[],
+    labeled_at = now()
+WHERE uuid = @uuid::uuid;
+
+-- name: ListThreads :many
+SELECT
+  t.uuid,
+  t.visitor_uuid,
+  t.title,
+  t.tags,
+  t.created_at,
+  t.last_activity_at,
+  t.archived_at,
+  t.flagged_at,
+  t.flag_reason,
+  t.taken_over_at,
+  (SELECT count(*) FROM chat_messages c WHERE c.thread_uuid = t.uuid) AS message_count,
+  (SELECT count(*) FROM chat_messages c WHERE c.thread_uuid = t.uuid AND c.role = 'user') AS user_message_count,
+  (SELECT count(*) FROM chat_messages c WHERE c.thread_uuid = t.uuid AND c.status = 'failed') AS failed_message_count,
+  (SELECT count(*) FROM chat_message_feedback f JOIN chat_messages c ON c.uuid = f.message_uuid WHERE c.thread_uuid = t.uuid AND f.rating = 'up') AS feedback_up,
+  (SELECT count(*) FROM chat_message_feedback f JOIN chat_messages c ON c.uuid = f.message_uuid WHERE c.thread_uuid = t.uuid AND f.rating = 'down') AS feedback_down
+FROM chat_threads t
+WHERE (sqlc.narg(tag)::text IS NULL OR t.tags @> ARRAY[sqlc.narg(tag)::text])
+  AND (sqlc.narg(visitor_uuid)::uuid IS NULL OR t.visitor_uuid = sqlc.narg(visitor_uuid)::uuid)
+  AND (NOT @flagged_only::boolean OR t.flagged_at IS NOT NULL)
+  AND (
+    sqlc.narg(cursor_activity)::timestamptz IS NULL
+    OR (t.last_activity_at, t.uuid) < (sqlc.narg(cursor_activity)::timestamptz, sqlc.narg(cursor_uuid)::uuid)
+  )
+ORDER BY t.last_activity_at DESC, t.uuid DESC
+LIMIT @page_size::int;
+
+-- name: FlagChatThread :exec
+UPDATE chat_threads
+SET flagged_at = COALESCE(flagged_at, now()),
+    flag_reason = $2
+WHERE uuid = $1;
+
+-- name: UnflagChatThread :exec
+UPDATE chat_threads
+SET flagged_at = NULL,
+    flag_reason = NULL
+WHERE uuid = $1;
+
+-- name: StartThreadTakeover :execrows
+UPDATE chat_threads
+SET taken_over_at = now()
+WHERE uuid = $1 AND taken_over_at IS NULL;
+
+-- name: EndThreadTakeover :execrows
+UPDATE chat_threads
+SET taken_over_at = NULL
+WHERE uuid = $1 AND taken_over_at IS NOT NULL;
+
+-- name: CountThreadEmotions :many
+SELECT emotion, count(*) AS count
+FROM chat_messages
+WHERE thread_uuid = $1 AND role = 'assistant' AND emotion IS NOT NULL
+GROUP BY emotion
+ORDER BY count DESC, emotion;
+
+-- name: ListThreadFeedback :many
+SELECT f.message_uuid, f.rating, f.reason, f.comment, f.created_at
+FROM chat_message_feedback f
+JOIN chat_messages m ON m.uuid = f.message_uuid
+WHERE m.thread_uuid = $1
+ORDER BY f.created_at;
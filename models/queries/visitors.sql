@@ -30,3 +30,25 @@ SET
   raw_headers = $8
 WHERE uuid = $1
 RETURNING *;
+
+-- name: ListVisitors :many
+SELECT
+  v.uuid,
+  v.ip_address,
+  v.user_agent,
+  v.accept_language,
+  v.referer,
+  v.created_at,
+  v.last_seen_at,
+  (SELECT count(*) FROM chat_threads t WHERE t.visitor_uuid = v.uuid) AS thread_count
+FROM visitors v
+WHERE (sqlc.narg(seen_after)::timestamptz IS NULL OR v.last_seen_at >= sqlc.narg(seen_after)::timestamptz)
+  AND (sqlc.narg(seen_before)::timestamptz IS NULL OR v.last_seen_at < sqlc.narg(seen_before)::timestamptz)
+  AND (sqlc.narg(ip_address)::text IS NULL OR v.ip_address = sqlc.narg(ip_address)::text)
+  AND (sqlc.narg(user_agent)::text IS NULL OR v.user_agent ILIKE '%' || sqlc.narg(user_agent)::text || '%')
+  AND (
+    sqlc.narg(cursor_seen)::timestamptz IS NULL
+    OR (v.last_seen_at, v.uuid) < (sqlc.narg(cursor_seen)::timestamptz, sqlc.narg(cursor_uuid)::uuid)
+  )
+ORDER BY v.last_seen_at DESC, v.uuid DESC
+LIMIT @page_size::int;
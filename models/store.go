@@ -0,0 +1,39 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"talk-to-ugur-back/models/db"
+)
+
+// Store runs the generated queries against the pool, or inside a transaction
+// with InTx.
+type Store struct {
+	*db.Queries
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{
+		Queries: db.New(pool),
+		pool:    pool,
+	}
+}
+
+// InTx runs fn in a transaction that is committed when fn returns nil and
+// rolled back otherwise.
+func (s *Store) InTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op.
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	if err := fn(s.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
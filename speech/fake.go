@@ -0,0 +1,73 @@
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const fakeTranscript = "Hello Ugur, this is a voice message."
+
+// FakeTranscriber works fully offline. If the uploaded "audio" is plain UTF-8
+// text it is used as the transcript, which lets local clients script whole
+// conversations; anything else yields a fixed sentence.
+type FakeTranscriber struct{}
+
+func (FakeTranscriber) Transcribe(ctx context.Context, audio Audio, filename string) (Transcription, error) {
+	if isPlainText(audio.Data) {
+		if text := strings.TrimSpace(string(audio.Data)); text != "" {
+			return Transcription{Text: text}, nil
+		}
+	}
+	return Transcription{Text: fakeTranscript}, nil
+}
+
+// FakeSynthesizer returns a silent WAV file whose length roughly matches how
+// long the text would take to say.
+type FakeSynthesizer struct{}
+
+func (FakeSynthesizer) Synthesize(ctx context.Context, text, emotion string) (Audio, error) {
+	const (
+		sampleRate     = 16000
+		msPerWord      = 350
+		minDurationMs  = 500
+		bytesPerSample = 2
+	)
+	durationMs := len(strings.Fields(text)) * msPerWord
+	if durationMs < minDurationMs {
+		durationMs = minDurationMs
+	}
+	dataSize := sampleRate * durationMs / 1000 * bytesPerSample
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*bytesPerSample))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(bytesPerSample))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(8*bytesPerSample))
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+
+	return Audio{ContentType: "audio/wav", Data: buf.Bytes()}, nil
+}
+
+func isPlainText(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"talk-to-ugur-back/config"
+)
+
+type openAIProvider struct {
+	baseURL    string
+	apiKey     string
+	sttModel   string
+	ttsModel   string
+	ttsVoice   string
+	httpClient *http.Client
+}
+
+func newOpenAIProvider(cfg *config.Config) *openAIProvider {
+	return &openAIProvider{
+		baseURL:  strings.TrimRight(cfg.OpenAIBaseURL, "/"),
+		apiKey:   cfg.OpenAIAPIKey,
+		sttModel: cfg.OpenAISTTModel,
+		ttsModel: cfg.OpenAITTSModel,
+		ttsVoice: cfg.OpenAITTSVoice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+func (p *openAIProvider) Transcribe(ctx context.Context, audio Audio, filename string) (Transcription, error) {
+	if p.apiKey == "" {
+		return Transcription{}, errors.New("missing OPENAI_API_KEY")
+	}
+	if strings.TrimSpace(filename) == "" {
+		filename = "audio"
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("model", p.sttModel); err != nil {
+		return Transcription{}, err
+	}
+	if err := writer.WriteField("response_format", "json"); err != nil {
+		return Transcription{}, err
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return Transcription{}, err
+	}
+	if _, err = part.Write(audio.Data); err != nil {
+		return Transcription{}, err
+	}
+	if err = writer.Close(); err != nil {
+		return Transcription{}, err
+	}
+
+	resp, err := p.do(ctx, "/audio/transcriptions", writer.FormDataContentType(), &body)
+	if err != nil {
+		return Transcription{}, err
+	}
+	defer resp.Body.Close()
+
+	var parsed struct {
+		Text string `json:"text"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return Transcription{}, err
+	}
+	return Transcription{Text: strings.TrimSpace(parsed.Text)}, nil
+}
+
+func (p *openAIProvider) Synthesize(ctx context.Context, text, emotion string) (Audio, error) {
+	if p.apiKey == "" {
+		return Audio{}, errors.New("missing OPENAI_API_KEY")
+	}
+
+	reqBody := map[string]any{
+		"model":           p.ttsModel,
+		"input":           text,
+		"voice":           p.ttsVoice,
+		"response_format": "mp3",
+	}
+	if emotion = strings.TrimSpace(emotion); emotion != "" {
+		reqBody["instructions"] = fmt.Sprintf("Speak naturally in a %s tone.", emotion)
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return Audio{}, err
+	}
+
+	resp, err := p.do(ctx, "/audio/speech", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return Audio{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Audio{}, err
+	}
+	return Audio{ContentType: "audio/mpeg", Data: data}, nil
+}
+
+func (p *openAIProvider) do(ctx context.Context, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("openai api error: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
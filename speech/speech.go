@@ -0,0 +1,51 @@
+package speech
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"talk-to-ugur-back/config"
+)
+
+type Transcription struct {
+	Text string
+}
+
+type Audio struct {
+	ContentType string
+	Data        []byte
+}
+
+// Transcriber turns recorded visitor audio into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio Audio, filename string) (Transcription, error)
+}
+
+// Synthesizer renders a reply as audio. The emotion is a hint for the tone of
+// voice and may be ignored by providers that do not support it.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text, emotion string) (Audio, error)
+}
+
+func NewTranscriber(cfg *config.Config) (Transcriber, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.SpeechSTTProvider)) {
+	case "", "openai":
+		return newOpenAIProvider(cfg), nil
+	case "fake":
+		return FakeTranscriber{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SPEECH_STT_PROVIDER %q", cfg.SpeechSTTProvider)
+	}
+}
+
+func NewSynthesizer(cfg *config.Config) (Synthesizer, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.SpeechTTSProvider)) {
+	case "", "openai":
+		return newOpenAIProvider(cfg), nil
+	case "fake":
+		return FakeSynthesizer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SPEECH_TTS_PROVIDER %q", cfg.SpeechTTSProvider)
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"talk-to-ugur-back/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+func NewStore(cfg *config.Config) (Store, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.StorageDriver)) {
+	case "", "local":
+		return NewLocalStore(cfg.StorageLocalDir), nil
+	case "s3":
+		return NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", cfg.StorageDriver)
+	}
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"talk-to-ugur-back/config"
+)
+
+// testStore checks the behavior every Store must have.
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	key := "attachments/0b0c7b4e-5a3c-4f5e-9a51-9d3f2f6f8a10.png"
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing object: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Put(ctx, key, "image/png", []byte("first")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(ctx, key, "image/png", []byte("second")); err != nil {
+		t.Fatalf("Put overwrite: %v", err)
+	}
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(data) != "second" {
+		t.Fatalf("Get = %q, want %q", data, "second")
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get deleted object: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete missing object: %v", err)
+	}
+	if err := store.Put(ctx, "", "image/png", []byte("x")); err == nil {
+		t.Fatal("Put with empty key succeeded")
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	testStore(t, NewLocalStore(t.TempDir()))
+}
+
+func TestLocalStoreKeyLayout(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "audio/a.mp3", "audio/mpeg", []byte("mp3")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "audio", "a.mp3")); err != nil || string(data) != "mp3" {
+		t.Fatalf("file at key path = %q, %v", data, err)
+	}
+
+	// Keys cannot leave the storage directory.
+	if err := store.Put(ctx, "../../escape.txt", "text/plain", []byte("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err != nil {
+		t.Fatalf("traversal key not kept inside the directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); err == nil {
+		t.Fatal("traversal key was written outside the directory")
+	}
+}
+
+// fakeS3 is an in-memory stand-in for an S3-compatible server with path-style
+// addressing.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if sha256Hex(data) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[path] = data
+		f.types[path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T, endpoint string, pathStyle bool) *S3Store {
+	t.Helper()
+	store, err := NewS3Store(&config.Config{
+		StorageS3Endpoint:  endpoint,
+		StorageS3Bucket:    "uploads",
+		StorageS3AccessKey: "test-key",
+		StorageS3SecretKey: "test-secret",
+		StorageS3PathStyle: pathStyle,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := newTestS3Store(t, server.URL, true)
+	testStore(t, store)
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "audio/a b.mp3", "audio/mpeg", []byte("mp3")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := fake.types["/uploads/audio/a%20b.mp3"]; got != "audio/mpeg" {
+		t.Fatalf("object stored at %v with content type %q", fake.objects, got)
+	}
+}
+
+func TestS3StoreKeyLayout(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		key       string
+		want      string
+	}{
+		{"path style", "http://localhost:9000", true, "attachments/a.png", "http://localhost:9000/uploads/attachments/a.png"},
+		{"virtual host", "https://s3.eu-central-1.amazonaws.com", false, "attachments/a.png", "https://uploads.s3.eu-central-1.amazonaws.com/attachments/a.png"},
+		{"endpoint path", "http://localhost:9000/s3/", true, "/audio/b.mp3", "http://localhost:9000/s3/uploads/audio/b.mp3"},
+		{"escaped key", "http://localhost:9000", true, "audio/ä b.mp3", "http://localhost:9000/uploads/audio/%C3%A4%20b.mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := newTestS3Store(t, tt.endpoint, tt.pathStyle).newRequest(ctx, http.MethodGet, tt.key, nil)
+			if err != nil {
+				t.Fatalf("newRequest: %v", err)
+			}
+			if got := req.URL.String(); got != tt.want {
+				t.Fatalf("URL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	if _, err := NewStore(&config.Config{StorageDriver: "local", StorageLocalDir: t.TempDir()}); err != nil {
+		t.Fatalf("local: %v", err)
+	}
+	if _, err := NewStore(&config.Config{StorageDriver: "s3"}); err == nil {
+		t.Fatal("s3 without endpoint succeeded")
+	}
+	if _, err := NewStore(&config.Config{StorageDriver: "ftp"}); err == nil {
+		t.Fatal("unknown driver succeeded")
+	}
+}
@@ -0,0 +1,60 @@
+package threadevents
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it.
+const subscriberBuffer = 16
+
+// MemoryBus delivers events to subscribers in this process.
+type MemoryBus struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[chan Event]struct{}
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: map[uuid.UUID]map[chan Event]struct{}{}}
+}
+
+func (b *MemoryBus) Publish(_ context.Context, event Event) error {
+	b.deliver(event)
+	return nil
+}
+
+func (b *MemoryBus) deliver(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[event.Thread] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *MemoryBus) Subscribe(thread uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subs[thread] == nil {
+		b.subs[thread] = map[chan Event]struct{}{}
+	}
+	b.subs[thread][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[thread], ch)
+			if len(b.subs[thread]) == 0 {
+				delete(b.subs, thread)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
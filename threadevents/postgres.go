@@ -0,0 +1,85 @@
+package threadevents
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	notifyChannel  = "thread_events"
+	reconnectDelay = 5 * time.Second
+)
+
+// PostgresBus publishes events with NOTIFY and keeps one connection that
+// LISTENs and hands them to the subscribers of this instance. Events sent
+// while the listener reconnects are lost.
+type PostgresBus struct {
+	pool   *pgxpool.Pool
+	memory *MemoryBus
+}
+
+func NewPostgresBus(ctx context.Context, pool *pgxpool.Pool) *PostgresBus {
+	b := &PostgresBus{
+		pool:   pool,
+		memory: NewMemoryBus(),
+	}
+	go b.listen(ctx)
+	return b
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", notifyChannel, string(payload))
+	return err
+}
+
+func (b *PostgresBus) Subscribe(thread uuid.UUID) (<-chan Event, func()) {
+	return b.memory.Subscribe(thread)
+}
+
+func (b *PostgresBus) listen(ctx context.Context) {
+	for {
+		if err := b.receive(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("thread events listener error: %v", err)
+		}
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *PostgresBus) receive(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN is bound to the session, so the connection is not returned to
+	// the pool.
+	defer conn.Hijack().Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("thread events payload error: %v", err)
+			continue
+		}
+		b.memory.deliver(event)
+	}
+}
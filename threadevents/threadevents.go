@@ -0,0 +1,53 @@
+// Package threadevents tells open streams and long polls about changes to a
+// chat thread, such as new messages or a human taking over.
+package threadevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"talk-to-ugur-back/config"
+)
+
+const (
+	// Message is published for every message stored in a thread.
+	Message = "message"
+	// TakeoverStarted and TakeoverEnded are published when a human takes
+	// over a thread and when the AI gets it back.
+	TakeoverStarted = "takeover_started"
+	TakeoverEnded   = "takeover_ended"
+)
+
+type Event struct {
+	Thread    uuid.UUID `json:"thread"`
+	Type      string    `json:"type"`
+	MessageID uuid.UUID `json:"message_id,omitempty"`
+}
+
+type Bus interface {
+	// Publish delivers the event to the current subscribers of its thread.
+	// Delivery is best effort: subscribers that fall behind miss events.
+	Publish(ctx context.Context, event Event) error
+	// Subscribe returns the events of a thread published from now on and a
+	// function that ends the subscription.
+	Subscribe(thread uuid.UUID) (<-chan Event, func())
+}
+
+// New returns the bus selected by THREAD_EVENTS_MODE: "memory" delivers
+// within this process and "postgres" uses LISTEN/NOTIFY so that events reach
+// every instance sharing the database. The postgres listener runs until ctx
+// is done.
+func New(ctx context.Context, cfg *config.Config, pool *pgxpool.Pool) (Bus, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.ThreadEventsMode)) {
+	case "", "memory":
+		return NewMemoryBus(), nil
+	case "postgres":
+		return NewPostgresBus(ctx, pool), nil
+	default:
+		return nil, fmt.Errorf("unknown THREAD_EVENTS_MODE %q", cfg.ThreadEventsMode)
+	}
+}
@@ -0,0 +1,52 @@
+package threadlabel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/models/db"
+)
+
+const labelSystemPrompt = `You label conversations between a visitor and Ugur on his personal website.
+Give the conversation a short title of at most six words, in the language of the conversation, and up to %d lowercase topic tags of one or two words each, in English.
+Answer with a JSON object {"title": "...", "tags": ["..."]}.`
+
+// AILabeler asks the chat model for labels with a small JSON schema.
+type AILabeler struct {
+	client  *ai.Client
+	maxTags int
+}
+
+func (l *AILabeler) Label(ctx context.Context, messages []db.ChatMessage) (Labels, error) {
+	var prompt strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&prompt, "%s: %s\n", msg.Role, msg.Content)
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"title": map[string]any{"type": "string"},
+			"tags": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "string"},
+			},
+		},
+		"required": []string{"title", "tags"},
+	}
+	raw, err := l.client.CompleteSchema(ctx, fmt.Sprintf(labelSystemPrompt, l.maxTags), prompt.String(), "thread_labels", schema)
+	if err != nil {
+		return Labels{}, err
+	}
+	var answer struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(raw), &answer); err != nil {
+		return Labels{}, fmt.Errorf("invalid labels %q: %w", raw, err)
+	}
+	return normalize(Labels{Title: answer.Title, Tags: answer.Tags}, l.maxTags), nil
+}
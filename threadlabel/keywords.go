@@ -0,0 +1,92 @@
+package threadlabel
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models/db"
+)
+
+const titleWords = 6
+
+// fillerWords are frequent English words that say nothing about a topic and
+// are not in the language detector's stopword lists.
+var fillerWords = map[string]bool{
+	"a": true, "an": true, "be": true, "been": true, "but": true, "did": true, "from": true,
+	"get": true, "had": true, "has": true, "her": true, "him": true, "his": true, "just": true,
+	"know": true, "like": true, "me": true, "more": true, "much": true, "really": true,
+	"some": true, "tell": true, "than": true, "them": true, "then": true, "there": true,
+	"they": true, "very": true, "want": true, "were": true, "when": true, "where": true,
+	"which": true, "who": true, "will": true, "yes": true, "you're": true, "ugur": true,
+}
+
+// KeywordLabeler labels threads without network access: the title is the
+// start of the first visitor message and the tags are the words the visitor
+// uses most, stopwords aside.
+type KeywordLabeler struct {
+	maxTags int
+}
+
+func (l *KeywordLabeler) Label(ctx context.Context, messages []db.ChatMessage) (Labels, error) {
+	var title string
+	counts := map[string]int{}
+	first := map[string]int{}
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		if title == "" {
+			title = firstWords(msg.Content, titleWords)
+		}
+		for _, word := range words(msg.Content) {
+			if utf8.RuneCountInString(word) < 3 || lang.IsStopword(word) || fillerWords[word] {
+				continue
+			}
+			if _, ok := first[word]; !ok {
+				first[word] = len(first)
+			}
+			counts[word]++
+		}
+	}
+
+	tags := make([]string, 0, len(counts))
+	for word := range counts {
+		tags = append(tags, word)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return first[tags[i]] < first[tags[j]]
+	})
+	return normalize(Labels{Title: title, Tags: tags}, l.maxTags), nil
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '+' && r != '#'
+	})
+}
+
+// firstWords returns the first sentence of text, cut to at most n words and
+// capitalized.
+func firstWords(text string, n int) string {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, ".?!\n"); i > 0 {
+		text = text[:i]
+	}
+	fields := strings.Fields(text)
+	if len(fields) > n {
+		fields = fields[:n]
+	}
+	title := strings.Join(fields, " ")
+	r, size := utf8.DecodeRuneInString(title)
+	if size == 0 {
+		return ""
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
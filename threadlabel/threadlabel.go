@@ -0,0 +1,107 @@
+// Package threadlabel names chat threads: a short title and a few topic tags
+// derived from the first exchange.
+package threadlabel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/models/db"
+)
+
+const (
+	maxTitleLength = 60
+	maxTagLength   = 32
+)
+
+type Labels struct {
+	Title string
+	Tags  []string
+}
+
+type Labeler interface {
+	Label(ctx context.Context, messages []db.ChatMessage) (Labels, error)
+}
+
+// New returns the labeler selected by THREAD_LABELS_PROVIDER: "ai" asks the
+// chat model, "keywords" picks frequent words locally and "off" disables
+// labeling. It defaults to "keywords" when AI_PROVIDER replays transcripts,
+// which have no answers for labeling requests, and to "ai" otherwise. A nil
+// Labeler means labeling is off.
+func New(cfg *config.Config, client *ai.Client) (Labeler, error) {
+	maxTags := cfg.ThreadLabelsMaxTags
+	if maxTags <= 0 {
+		maxTags = 5
+	}
+	provider := strings.ToLower(strings.TrimSpace(cfg.ThreadLabelsProvider))
+	if provider == "" {
+		provider = "ai"
+		if strings.EqualFold(strings.TrimSpace(cfg.AIProvider), "replay") {
+			provider = "keywords"
+		}
+	}
+	switch provider {
+	case "ai":
+		return &AILabeler{client: client, maxTags: maxTags}, nil
+	case "keywords":
+		return &KeywordLabeler{maxTags: maxTags}, nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown THREAD_LABELS_PROVIDER %q", cfg.ThreadLabelsProvider)
+	}
+}
+
+// normalize trims the title to maxTitleLength runes and turns tags into
+// unique lowercase slugs, at most maxTags of them.
+func normalize(labels Labels, maxTags int) Labels {
+	title := strings.Join(strings.Fields(labels.Title), " ")
+	title = strings.Trim(title, `"'.`)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+		if i := strings.LastIndex(title, " "); i > 0 {
+			title = title[:i]
+		}
+	}
+
+	tags := make([]string, 0, maxTags)
+	seen := map[string]bool{}
+	for _, tag := range labels.Tags {
+		tag = slug(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return Labels{Title: title, Tags: tags}
+}
+
+func slug(tag string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(tag)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '+' || r == '#':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+		if b.Len() >= maxTagLength {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package threadlock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryLocker serializes threads within one process. Waiters are served in
+// no particular order.
+type MemoryLocker struct {
+	wait  time.Duration
+	mu    sync.Mutex
+	locks map[uuid.UUID]*memoryLock
+}
+
+type memoryLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+func NewMemoryLocker(wait time.Duration) *MemoryLocker {
+	return &MemoryLocker{
+		wait:  wait,
+		locks: map[uuid.UUID]*memoryLock{},
+	}
+}
+
+func (l *MemoryLocker) Lock(ctx context.Context, thread uuid.UUID) (func(), error) {
+	l.mu.Lock()
+	lock := l.locks[thread]
+	if lock == nil {
+		lock = &memoryLock{sem: make(chan struct{}, 1)}
+		l.locks[thread] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	if err := l.acquire(ctx, lock); err != nil {
+		l.release(thread, lock, false)
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(thread, lock, true) })
+	}, nil
+}
+
+func (l *MemoryLocker) acquire(ctx context.Context, lock *memoryLock) error {
+	select {
+	case lock.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.wait <= 0 {
+		return ErrBusy
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case lock.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *MemoryLocker) release(thread uuid.UUID, lock *memoryLock, held bool) {
+	if held {
+		<-lock.sem
+	}
+	l.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, thread)
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,156 @@
+package threadlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/config"
+)
+
+func TestMemoryLockerBusy(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker(0)
+	thread, other := uuid.New(), uuid.New()
+
+	unlock, err := locker.Lock(ctx, thread)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if _, err := locker.Lock(ctx, thread); !errors.Is(err, ErrBusy) {
+		t.Fatalf("second Lock err = %v, want ErrBusy", err)
+	}
+	unlockOther, err := locker.Lock(ctx, other)
+	if err != nil {
+		t.Fatalf("Lock of another thread: %v", err)
+	}
+	unlockOther()
+
+	unlock()
+	// Unlocking twice must not release a lock taken in between.
+	again, err := locker.Lock(ctx, thread)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock()
+	if _, err := locker.Lock(ctx, thread); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Lock after a second unlock err = %v, want ErrBusy", err)
+	}
+	again()
+
+	if n := len(locker.locks); n != 0 {
+		t.Fatalf("%d locks left after all were released", n)
+	}
+}
+
+func TestMemoryLockerWait(t *testing.T) {
+	ctx := context.Background()
+	thread := uuid.New()
+
+	t.Run("acquired when released", func(t *testing.T) {
+		locker := NewMemoryLocker(time.Minute)
+		unlock, err := locker.Lock(ctx, thread)
+		if err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		time.AfterFunc(10*time.Millisecond, unlock)
+		next, err := locker.Lock(ctx, thread)
+		if err != nil {
+			t.Fatalf("waiting Lock: %v", err)
+		}
+		next()
+	})
+
+	t.Run("busy after the wait time", func(t *testing.T) {
+		locker := NewMemoryLocker(10 * time.Millisecond)
+		unlock, err := locker.Lock(ctx, thread)
+		if err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		defer unlock()
+		if _, err := locker.Lock(ctx, thread); !errors.Is(err, ErrBusy) {
+			t.Fatalf("waiting Lock err = %v, want ErrBusy", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		locker := NewMemoryLocker(time.Minute)
+		unlock, err := locker.Lock(ctx, thread)
+		if err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		defer unlock()
+		cancelled, cancel := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if _, err := locker.Lock(cancelled, thread); !errors.Is(err, context.Canceled) {
+			t.Fatalf("waiting Lock err = %v, want context.Canceled", err)
+		}
+		if refs := locker.locks[thread].refs; refs != 1 {
+			t.Fatalf("refs = %d after the waiter gave up, want 1", refs)
+		}
+	})
+}
+
+func TestMemoryLockerExclusive(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker(time.Minute)
+	thread := uuid.New()
+
+	var inside atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := locker.Lock(ctx, thread)
+			if err != nil {
+				t.Errorf("Lock: %v", err)
+				return
+			}
+			if n := inside.Add(1); n != 1 {
+				t.Errorf("%d holders at once, want 1", n)
+			}
+			time.Sleep(time.Millisecond)
+			inside.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+	if n := len(locker.locks); n != 0 {
+		t.Fatalf("%d locks left after all were released", n)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{mode: "", want: "*threadlock.MemoryLocker"},
+		{mode: " Memory ", want: "*threadlock.MemoryLocker"},
+		{mode: "off", want: "threadlock.noopLocker"},
+		{mode: "redis"},
+	}
+	for _, tt := range tests {
+		locker, err := New(&config.Config{ThreadLockMode: tt.mode}, nil)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("New(%q) succeeded", tt.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.mode, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", locker); got != tt.want {
+			t.Errorf("New(%q) = %s, want %s", tt.mode, got, tt.want)
+		}
+	}
+}
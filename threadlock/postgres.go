@@ -0,0 +1,111 @@
+package threadlock
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	pollInterval = 100 * time.Millisecond
+	// acquireTimeout bounds the wait for a lock connection when the lock
+	// wait time is shorter, so that connecting does not count as busy.
+	acquireTimeout = 2 * time.Second
+)
+
+// PostgresLocker holds a session advisory lock per thread, so that threads
+// are serialized across instances sharing the database. Requests of the same
+// instance queue in memory first and only then hold a connection. The
+// connections come from a pool of their own, so busy threads never take
+// connections away from queries.
+type PostgresLocker struct {
+	pool   *pgxpool.Pool
+	wait   time.Duration
+	memory *MemoryLocker
+}
+
+// NewPostgresLocker opens a pool of at most maxConns connections for the
+// locks, configured like pool otherwise.
+func NewPostgresLocker(pool *pgxpool.Pool, maxConns int32, wait time.Duration) (*PostgresLocker, error) {
+	lockConfig := pool.Config()
+	lockConfig.MaxConns = max(maxConns, 1)
+	lockConfig.MinConns = 0
+	lockPool, err := pgxpool.NewWithConfig(context.Background(), lockConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresLocker{
+		pool:   lockPool,
+		wait:   wait,
+		memory: NewMemoryLocker(wait),
+	}, nil
+}
+
+func (l *PostgresLocker) Lock(ctx context.Context, thread uuid.UUID) (func(), error) {
+	deadline := time.Now().Add(l.wait)
+	unlockMemory, err := l.memory.Lock(ctx, thread)
+	if err != nil {
+		return nil, err
+	}
+
+	// All lock connections in use means as many threads are busy.
+	acquireCtx, cancel := context.WithTimeout(ctx, max(time.Until(deadline), acquireTimeout))
+	conn, err := l.pool.Acquire(acquireCtx)
+	cancel()
+	if err != nil {
+		unlockMemory()
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrBusy
+		}
+		return nil, err
+	}
+	key := advisoryKey(thread)
+	for {
+		var locked bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+			conn.Release()
+			unlockMemory()
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			conn.Release()
+			unlockMemory()
+			return nil, ErrBusy
+		}
+		select {
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		case <-ctx.Done():
+			conn.Release()
+			unlockMemory()
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+			// Closing the session drops its advisory locks.
+			log.Printf("thread unlock error: %v", err)
+			_ = conn.Conn().Close(unlockCtx)
+		}
+		conn.Release()
+		unlockMemory()
+	}, nil
+}
+
+// advisoryKey maps a thread to the 64-bit key space of advisory locks.
+func advisoryKey(thread uuid.UUID) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("chat_thread:"))
+	h.Write(thread[:])
+	return int64(h.Sum64())
+}
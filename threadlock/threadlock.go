@@ -0,0 +1,49 @@
+// Package threadlock serializes work on a chat thread, so that only one
+// message per thread is being answered at a time.
+package threadlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"talk-to-ugur-back/config"
+)
+
+// ErrBusy is returned when the thread is still locked after the wait time.
+var ErrBusy = errors.New("thread is busy")
+
+type Locker interface {
+	// Lock waits until the thread is free, at most for the configured wait
+	// time, and returns a function that releases it.
+	Lock(ctx context.Context, thread uuid.UUID) (func(), error)
+}
+
+// New returns the locker selected by THREAD_LOCK_MODE: "memory" serializes
+// within this process, "postgres" additionally takes an advisory lock so
+// several instances share it, and "off" disables locking. The postgres mode
+// opens its own pool of THREAD_LOCK_MAX_CONNS connections next to pool.
+func New(cfg *config.Config, pool *pgxpool.Pool) (Locker, error) {
+	wait := time.Duration(cfg.ThreadLockWaitSeconds) * time.Second
+	switch strings.ToLower(strings.TrimSpace(cfg.ThreadLockMode)) {
+	case "", "memory":
+		return NewMemoryLocker(wait), nil
+	case "postgres":
+		return NewPostgresLocker(pool, int32(cfg.ThreadLockMaxConns), wait)
+	case "off":
+		return noopLocker{}, nil
+	default:
+		return nil, fmt.Errorf("unknown THREAD_LOCK_MODE %q", cfg.ThreadLockMode)
+	}
+}
+
+type noopLocker struct{}
+
+func (noopLocker) Lock(context.Context, uuid.UUID) (func(), error) {
+	return func() {}, nil
+}
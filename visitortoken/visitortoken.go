@@ -0,0 +1,98 @@
+// Package visitortoken signs visitor ids, so that a visitor can only be
+// claimed by whoever it was issued to.
+package visitortoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/config"
+)
+
+var ErrInvalid = errors.New("invalid visitor token")
+
+// Signer issues tokens of the form "<visitor uuid>.<key id>.<signature>",
+// where the signature is an HMAC-SHA256 of the visitor uuid. Tokens are
+// signed with the current key and verified with any configured key, so keys
+// can be rotated by adding a new one and dropping the old one later.
+type Signer struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewSigner reads the keys from VISITOR_TOKEN_KEYS ("id:secret,...") and the
+// signing key from VISITOR_TOKEN_KEY_ID. Without keys it makes up a random
+// one, so tokens stop working on restart.
+func NewSigner(cfg *config.Config) (*Signer, error) {
+	keys := make(map[string][]byte, len(cfg.VisitorTokenKeys))
+	for id, secret := range cfg.VisitorTokenKeys {
+		id = strings.TrimSpace(id)
+		if id == "" || strings.Contains(id, ".") {
+			return nil, fmt.Errorf("invalid visitor token key id %q", id)
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("visitor token key %q must be at least 32 characters", id)
+		}
+		keys[id] = []byte(secret)
+	}
+
+	if len(keys) == 0 {
+		log.Printf("VISITOR_TOKEN_KEYS is empty, using a random key; visitor tokens will not survive a restart")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return &Signer{current: "dev", keys: map[string][]byte{"dev": secret}}, nil
+	}
+
+	current := strings.TrimSpace(cfg.VisitorTokenKeyID)
+	if current == "" && len(keys) == 1 {
+		for id := range keys {
+			current = id
+		}
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("VISITOR_TOKEN_KEY_ID %q is not in VISITOR_TOKEN_KEYS", cfg.VisitorTokenKeyID)
+	}
+	return &Signer{current: current, keys: keys}, nil
+}
+
+func (s *Signer) Sign(visitor uuid.UUID) string {
+	return visitor.String() + "." + s.current + "." + s.signature(s.keys[s.current], visitor)
+}
+
+// Verify returns the visitor of a token and whether it was signed with an
+// older key and should be reissued.
+func (s *Signer) Verify(token string) (uuid.UUID, bool, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return uuid.Nil, false, ErrInvalid
+	}
+	visitor, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, false, ErrInvalid
+	}
+	key, ok := s.keys[parts[1]]
+	if !ok {
+		return uuid.Nil, false, ErrInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(key, visitor))) {
+		return uuid.Nil, false, ErrInvalid
+	}
+	return visitor, parts[1] != s.current, nil
+}
+
+func (s *Signer) signature(key []byte, visitor uuid.UUID) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("visitor:"))
+	mac.Write(visitor[:])
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
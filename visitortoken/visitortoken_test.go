@@ -0,0 +1,109 @@
+package visitortoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/config"
+)
+
+const (
+	oldSecret = "0123456789abcdef0123456789abcdef"
+	newSecret = "fedcba9876543210fedcba9876543210"
+)
+
+func newTestSigner(t *testing.T, current string, keys map[string]string) *Signer {
+	t.Helper()
+	signer, err := NewSigner(&config.Config{VisitorTokenKeys: keys, VisitorTokenKeyID: current})
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return signer
+}
+
+func TestVerify(t *testing.T) {
+	visitor := uuid.MustParse("6f1c1a52-3d0e-4b7a-9f61-2c8d5e4a7b90")
+	old := newTestSigner(t, "old", map[string]string{"old": oldSecret})
+	rotated := newTestSigner(t, "new", map[string]string{"old": oldSecret, "new": newSecret})
+	retired := newTestSigner(t, "new", map[string]string{"new": newSecret})
+
+	valid := rotated.Sign(visitor)
+	parts := strings.Split(valid, ".")
+	forged := newTestSigner(t, "new", map[string]string{"new": strings.Repeat("x", 32)}).Sign(visitor)
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+		stale  bool
+		err    bool
+	}{
+		{name: "valid", signer: rotated, token: valid},
+		{name: "old key after rotation", signer: rotated, token: old.Sign(visitor), stale: true},
+		{name: "retired key", signer: retired, token: old.Sign(visitor), err: true},
+		{name: "wrong signature", signer: rotated, token: forged, err: true},
+		{name: "signature of another visitor", signer: rotated, token: uuid.NewString() + ".new." + parts[2], err: true},
+		{name: "unknown kid", signer: rotated, token: parts[0] + ".other." + parts[2], err: true},
+		{name: "empty", signer: rotated, token: "", err: true},
+		{name: "missing part", signer: rotated, token: parts[0] + "." + parts[1], err: true},
+		{name: "extra part", signer: rotated, token: valid + ".x", err: true},
+		{name: "invalid uuid", signer: rotated, token: "visitor.new." + parts[2], err: true},
+		{name: "empty signature", signer: rotated, token: parts[0] + ".new.", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stale, err := tt.signer.Verify(tt.token)
+			if tt.err {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Verify(%q) err = %v, want ErrInvalid", tt.token, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify(%q): %v", tt.token, err)
+			}
+			if got != visitor || stale != tt.stale {
+				t.Fatalf("Verify(%q) = %s, %v, want %s, %v", tt.token, got, stale, visitor, tt.stale)
+			}
+		})
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		current string
+		wantKid string
+		err     bool
+	}{
+		{name: "single key is current", keys: map[string]string{"a": oldSecret}, wantKid: "a"},
+		{name: "explicit current", keys: map[string]string{"a": oldSecret, "b": newSecret}, current: "b", wantKid: "b"},
+		{name: "no keys", wantKid: "dev"},
+		{name: "ambiguous current", keys: map[string]string{"a": oldSecret, "b": newSecret}, err: true},
+		{name: "unknown current", keys: map[string]string{"a": oldSecret}, current: "b", err: true},
+		{name: "short secret", keys: map[string]string{"a": "short"}, err: true},
+		{name: "dot in kid", keys: map[string]string{"a.b": oldSecret}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(&config.Config{VisitorTokenKeys: tt.keys, VisitorTokenKeyID: tt.current})
+			if tt.err {
+				if err == nil {
+					t.Fatal("NewSigner succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSigner: %v", err)
+			}
+			token := signer.Sign(uuid.New())
+			if kid := strings.Split(token, ".")[1]; kid != tt.wantKid {
+				t.Fatalf("token signed with %q, want %q", kid, tt.wantKid)
+			}
+		})
+	}
+}
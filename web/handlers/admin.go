@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/models"
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/storage"
+	"talk-to-ugur-back/threadevents"
+	"talk-to-ugur-back/threadlabel"
+	"talk-to-ugur-back/threadlock"
+)
+
+type AdminHandler struct {
+	queries *models.Store
+	ai      *ai.Client
+	labeler threadlabel.Labeler
+	events  threadevents.Bus
+	locker  threadlock.Locker
+	store   storage.Store
+	catalog *emotion.Catalog
+	cfg     *config.Config
+}
+
+func NewAdminHandler(queries *models.Store, aiClient *ai.Client, labeler threadlabel.Labeler, events threadevents.Bus, locker threadlock.Locker, store storage.Store, catalog *emotion.Catalog, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		queries: queries,
+		ai:      aiClient,
+		labeler: labeler,
+		events:  events,
+		locker:  locker,
+		store:   store,
+		catalog: catalog,
+		cfg:     cfg,
+	}
+}
+
+type promptResponse struct {
+	ID               string          `json:"id"`
+	MessageID        string          `json:"message_id"`
+	Model            string          `json:"model"`
+	Temperature      float64         `json:"temperature"`
+	ResponseFormat   string          `json:"response_format"`
+	SystemPrompt     string          `json:"system_prompt"`
+	SystemPromptHash string          `json:"system_prompt_hash"`
+	HistoryIDs       []string        `json:"history_ids"`
+	Request          json.RawMessage `json:"request"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type replayRequest struct {
+	Model string `json:"model"`
+}
+
+type replayResponse struct {
+	Original messageResponse `json:"original"`
+	Replay   struct {
+		Model    string `json:"model"`
+		Content  string `json:"content"`
+		Emotion  string `json:"emotion"`
+		Language string `json:"language,omitempty"`
+	} `json:"replay"`
+}
+
+func (h *AdminHandler) HandleGetPrompt(c *gin.Context) {
+	_, prompt, ok := h.loadPrompt(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toPromptResponse(prompt))
+}
+
+func (h *AdminHandler) HandleReplayPrompt(c *gin.Context) {
+	msg, prompt, ok := h.loadPrompt(c)
+	if !ok {
+		return
+	}
+
+	var req replayRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+
+	reply, err := h.ai.Replay(c.Request.Context(), prompt.Request, req.Model)
+	if err != nil {
+		log.Printf("ai replay error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "ai request failed"})
+		return
+	}
+
+	var resp replayResponse
+	resp.Original = toMessageResponse(msg, nil)
+	resp.Replay.Model = prompt.Model
+	if req.Model != "" {
+		resp.Replay.Model = req.Model
+	}
+	resp.Replay.Content = reply.Text
+	resp.Replay.Emotion = reply.Emotion
+	resp.Replay.Language = reply.Language
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AdminHandler) loadPrompt(c *gin.Context) (db.ChatMessage, db.ChatPrompt, bool) {
+	messageUUID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message_id"})
+		return db.ChatMessage{}, db.ChatPrompt{}, false
+	}
+
+	ctx := c.Request.Context()
+	msg, err := h.queries.GetChatMessage(ctx, pgUUID(messageUUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return db.ChatMessage{}, db.ChatPrompt{}, false
+	}
+	prompt, err := h.queries.GetChatPromptByMessage(ctx, msg.Uuid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no prompt captured for message"})
+			return db.ChatMessage{}, db.ChatPrompt{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load prompt"})
+		return db.ChatMessage{}, db.ChatPrompt{}, false
+	}
+	return msg, prompt, true
+}
+
+func toPromptResponse(prompt db.ChatPrompt) promptResponse {
+	historyIDs := make([]string, 0, len(prompt.HistoryUuids))
+	for _, id := range prompt.HistoryUuids {
+		historyIDs = append(historyIDs, uuidString(id))
+	}
+	return promptResponse{
+		ID:               uuidString(prompt.Uuid),
+		MessageID:        uuidString(prompt.MessageUuid),
+		Model:            prompt.Model,
+		Temperature:      prompt.Temperature,
+		ResponseFormat:   prompt.ResponseFormat,
+		SystemPrompt:     prompt.SystemPrompt,
+		SystemPromptHash: prompt.SystemPromptHash,
+		HistoryIDs:       historyIDs,
+		Request:          json.RawMessage(prompt.Request),
+		CreatedAt:        timeFromPg(prompt.CreatedAt),
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/models/db"
+)
+
+type emotionRequest struct {
+	Description string   `json:"description"`
+	Triggers    []string `json:"triggers"`
+	Weight      *float64 `json:"weight"`
+	// Position orders the emotions in the prompt. Omitted keeps the current
+	// position, or appends a new emotion at the end.
+	Position *int32 `json:"position"`
+}
+
+type emotionResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Triggers    []string  `json:"triggers"`
+	Weight      float64   `json:"weight"`
+	Position    int32     `json:"position"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (h *AdminHandler) HandleListEmotions(c *gin.Context) {
+	rows, err := h.queries.ListEmotions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load emotions"})
+		return
+	}
+	resp := make([]emotionResponse, 0, len(rows))
+	for _, row := range rows {
+		resp = append(resp, toEmotionResponse(row))
+	}
+	c.JSON(http.StatusOK, gin.H{"emotions": resp})
+}
+
+func (h *AdminHandler) HandlePutEmotion(c *gin.Context) {
+	var req emotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	def := emotion.Definition{
+		Name:        emotion.NormalizeName(c.Param("name")),
+		Description: req.Description,
+		Triggers:    req.Triggers,
+		Weight:      1,
+	}
+	if req.Weight != nil {
+		if *req.Weight <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weight must be positive"})
+			return
+		}
+		def.Weight = *req.Weight
+	}
+	if err := def.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The avatar must be able to show every emotion the model may pick.
+	if _, err := h.catalog.Resolve(def.Name, h.cfg.AIEmotionFallbacks); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rows, err := h.queries.ListEmotions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load emotions"})
+		return
+	}
+	position := int32(0)
+	for _, row := range rows {
+		if row.Name == def.Name {
+			position = row.Position
+			break
+		}
+		if row.Position >= position {
+			position = row.Position + 1
+		}
+	}
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	row, err := h.queries.UpsertEmotion(ctx, upsertEmotionParams(def, position))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save emotion"})
+		return
+	}
+	h.reloadEmotions(ctx)
+	c.JSON(http.StatusOK, toEmotionResponse(row))
+}
+
+func (h *AdminHandler) HandleDeleteEmotion(c *gin.Context) {
+	name := emotion.NormalizeName(c.Param("name"))
+	ctx := c.Request.Context()
+	rows, err := h.queries.ListEmotions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load emotions"})
+		return
+	}
+	if len(rows) == 1 && rows[0].Name == name {
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot delete the last emotion"})
+		return
+	}
+
+	deleted, err := h.queries.DeleteEmotion(ctx, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete emotion"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "emotion not found"})
+		return
+	}
+	h.reloadEmotions(ctx)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) reloadEmotions(ctx context.Context) {
+	if err := LoadEmotions(ctx, h.queries.Queries, h.ai.Emotions()); err != nil {
+		log.Printf("emotion reload error: %v", err)
+	}
+}
+
+// LoadEmotions replaces the emotion set with the one stored in the database.
+// An empty table is seeded with the current set first, so the configured
+// emotions are only used until the first start against a database.
+func LoadEmotions(ctx context.Context, queries *db.Queries, set *emotion.Set) error {
+	rows, err := queries.ListEmotions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		for i, def := range set.Definitions() {
+			if _, err := queries.UpsertEmotion(ctx, upsertEmotionParams(def, int32(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	defs := make([]emotion.Definition, 0, len(rows))
+	for _, row := range rows {
+		defs = append(defs, emotion.Definition{
+			Name:        row.Name,
+			Description: row.Description,
+			Triggers:    row.Triggers,
+			Weight:      row.Weight,
+		})
+	}
+	set.Replace(defs)
+	return nil
+}
+
+func upsertEmotionParams(def emotion.Definition, position int32) db.UpsertEmotionParams {
+	triggers := def.Triggers
+	if triggers == nil {
+		triggers = []string{}
+	}
+	weight := def.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	return db.UpsertEmotionParams{
+		Name:        def.Name,
+		Description: def.Description,
+		Triggers:    triggers,
+		Weight:      weight,
+		Position:    position,
+	}
+}
+
+func toEmotionResponse(row db.Emotion) emotionResponse {
+	triggers := row.Triggers
+	if triggers == nil {
+		triggers = []string{}
+	}
+	return emotionResponse{
+		Name:        row.Name,
+		Description: row.Description,
+		Triggers:    triggers,
+		Weight:      row.Weight,
+		Position:    row.Position,
+		UpdatedAt:   timeFromPg(row.UpdatedAt),
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/models/db"
+)
+
+type feedbackStat struct {
+	Key      string           `json:"key"`
+	Bucket   *time.Time       `json:"bucket,omitempty"`
+	Up       int64            `json:"up"`
+	Down     int64            `json:"down"`
+	Total    int64            `json:"total"`
+	Score    float64          `json:"score"`
+	Comments int64            `json:"comments"`
+	Reasons  map[string]int64 `json:"reasons,omitempty"`
+}
+
+// HandleFeedbackStats aggregates reply ratings by prompt version, model or
+// emotion, optionally per day, week or month.
+func (h *AdminHandler) HandleFeedbackStats(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "prompt_version")
+	if groupBy != "prompt_version" && groupBy != "model" && groupBy != "emotion" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be prompt_version, model or emotion"})
+		return
+	}
+	bucket := c.Query("interval")
+	if bucket != "" && bucket != "day" && bucket != "week" && bucket != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+	from, err := parseSearchTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+		return
+	}
+	to, err := parseSearchTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rows, err := h.queries.FeedbackStats(ctx, db.FeedbackStatsParams{
+		GroupBy:     groupBy,
+		Bucket:      bucket,
+		CreatedFrom: from,
+		CreatedTo:   to,
+	})
+	if err != nil {
+		log.Printf("feedback stats error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback stats"})
+		return
+	}
+	// Reasons are only broken down for whole periods.
+	var reasons map[string]map[string]int64
+	if bucket == "" {
+		reasonRows, err := h.queries.FeedbackReasonStats(ctx, db.FeedbackReasonStatsParams{
+			GroupBy:     groupBy,
+			CreatedFrom: from,
+			CreatedTo:   to,
+		})
+		if err != nil {
+			log.Printf("feedback stats error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback stats"})
+			return
+		}
+		reasons = map[string]map[string]int64{}
+		for _, row := range reasonRows {
+			if reasons[row.GroupKey] == nil {
+				reasons[row.GroupKey] = map[string]int64{}
+			}
+			reasons[row.GroupKey][row.Reason.String] = row.Count
+		}
+	}
+
+	stats := make([]feedbackStat, 0, len(rows))
+	for _, row := range rows {
+		stat := feedbackStat{
+			Key:      row.GroupKey,
+			Up:       row.Up,
+			Down:     row.Down,
+			Total:    row.Up + row.Down,
+			Comments: row.Comments,
+			Reasons:  reasons[row.GroupKey],
+		}
+		if stat.Total > 0 {
+			stat.Score = float64(row.Up) / float64(stat.Total)
+		}
+		if row.Bucket.Valid {
+			start := row.Bucket.Time
+			stat.Bucket = &start
+		}
+		stats = append(stats, stat)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group_by": groupBy,
+		"interval": bucket,
+		"stats":    stats,
+	})
+}
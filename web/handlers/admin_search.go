@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models/db"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	maxSearchOffset       = 1000
+)
+
+type searchResult struct {
+	MessageID   string    `json:"message_id"`
+	ThreadID    string    `json:"thread_id"`
+	ThreadURL   string    `json:"thread_url"`
+	ThreadTitle *string   `json:"thread_title"`
+	VisitorID   string    `json:"visitor_id,omitempty"`
+	Role        string    `json:"role"`
+	Emotion     *string   `json:"emotion,omitempty"`
+	Language    *string   `json:"language,omitempty"`
+	Snippet     string    `json:"snippet"`
+	Rank        float32   `json:"rank"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// HandleSearchMessages finds messages matching q, best matches first. The
+// query is stemmed in the language given as ?language= or detected from it,
+// and also matched word for word, so it finds messages in any language.
+func (h *AdminHandler) HandleSearchMessages(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	language := lang.Normalize(c.Query("language"))
+	if language == "" {
+		language = lang.Detect(query).Code
+	}
+	params := db.SearchChatMessagesParams{
+		Query:    query,
+		Language: language,
+		Role:     pgText(c.Query("role")),
+		Emotion:  pgText(c.Query("emotion")),
+	}
+
+	var err error
+	pageSize := defaultSearchPageSize
+	if raw := c.Query("limit"); raw != "" {
+		pageSize, err = strconv.Atoi(raw)
+		if err != nil || pageSize <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		pageSize = min(pageSize, maxSearchPageSize)
+	}
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 || offset > maxSearchOffset {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+	}
+	// One extra row tells whether there is a next page.
+	params.PageSize = int32(pageSize + 1)
+	params.PageOffset = int32(offset)
+
+	if raw := c.Query("visitor_id"); raw != "" {
+		visitorUUID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visitor_id"})
+			return
+		}
+		params.VisitorUuid = pgUUID(visitorUUID)
+	}
+	if params.CreatedFrom, err = parseSearchTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+		return
+	}
+	if params.CreatedTo, err = parseSearchTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+		return
+	}
+
+	rows, err := h.queries.SearchChatMessages(c.Request.Context(), params)
+	if err != nil {
+		log.Printf("search messages error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search messages"})
+		return
+	}
+
+	var nextOffset *int
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		next := offset + pageSize
+		nextOffset = &next
+	}
+	results := make([]searchResult, 0, len(rows))
+	for _, row := range rows {
+		threadID := uuidString(row.ThreadUuid)
+		result := searchResult{
+			MessageID: uuidString(row.Uuid),
+			ThreadID:  threadID,
+			ThreadURL: "/admin/api/threads/" + threadID,
+			VisitorID: uuidString(row.VisitorUuid),
+			Role:      row.Role,
+			Snippet:   highlightSnippet(row.Snippet),
+			Rank:      row.Rank,
+			CreatedAt: timeFromPg(row.CreatedAt),
+		}
+		if row.ThreadTitle.Valid {
+			title := row.ThreadTitle.String
+			result.ThreadTitle = &title
+		}
+		if row.Emotion.Valid {
+			value := row.Emotion.String
+			result.Emotion = &value
+		}
+		if row.Language.Valid {
+			value := row.Language.String
+			result.Language = &value
+		}
+		results = append(results, result)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"query":       query,
+		"language":    language,
+		"results":     results,
+		"next_offset": nextOffset,
+	})
+}
+
+// parseSearchTime accepts RFC 3339 timestamps and dates. Dates used as upper
+// bound include the whole day.
+func parseSearchTime(raw string, end bool) (pgtype.Timestamptz, error) {
+	if raw == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, raw); err == nil {
+		return pgtype.Timestamptz{Time: ts, Valid: true}, nil
+	}
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return pgtype.Timestamptz{Time: day, Valid: true}, nil
+}
+
+// highlightSnippet escapes a ts_headline fragment for HTML and turns its
+// match delimiters, which the query sets to control characters so they
+// cannot clash with message text, into <mark> tags.
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/emotion"
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/threadevents"
+)
+
+type humanMessageRequest struct {
+	Content string `json:"content"`
+	Emotion string `json:"emotion"`
+}
+
+// HandleStartTakeover pauses the AI in a thread so that a human can answer.
+// A reply that is already being generated is still delivered.
+func (h *AdminHandler) HandleStartTakeover(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	started, err := h.queries.StartThreadTakeover(ctx, thread.Uuid)
+	if err != nil {
+		log.Printf("start takeover error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to take over thread"})
+		return
+	}
+	if started > 0 {
+		publishEvent(ctx, h.events, threadevents.Event{
+			Thread: uuid.UUID(thread.Uuid.Bytes),
+			Type:   threadevents.TakeoverStarted,
+		})
+	}
+	h.respondThread(c, thread.Uuid)
+}
+
+// HandleEndTakeover hands the thread back to the AI, which answers the next
+// visitor message. Messages sent during the takeover stay unanswered by it.
+func (h *AdminHandler) HandleEndTakeover(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	ended, err := h.queries.EndThreadTakeover(ctx, thread.Uuid)
+	if err != nil {
+		log.Printf("end takeover error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hand back thread"})
+		return
+	}
+	if ended > 0 {
+		publishEvent(ctx, h.events, threadevents.Event{
+			Thread: uuid.UUID(thread.Uuid.Bytes),
+			Type:   threadevents.TakeoverEnded,
+		})
+	}
+	h.respondThread(c, thread.Uuid)
+}
+
+// HandleSendHumanMessage stores a message written by a human as the persona at
+// the end of the thread's active branch and delivers it to the visitor.
+func (h *AdminHandler) HandleSendHumanMessage(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	if !thread.TakenOverAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "thread is not taken over"})
+		return
+	}
+
+	var req humanMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
+	name := emotion.NormalizeName(req.Emotion)
+	if names := h.ai.Emotions().Names(); !slices.Contains(names, name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "emotion must be one of: " + strings.Join(names, ", ")})
+		return
+	}
+
+	// A reply the AI is still writing would otherwise get the same parent.
+	unlock, ok := lockThread(c, h.locker, uuid.UUID(thread.Uuid.Bytes))
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	ctx := c.Request.Context()
+	var msg db.ChatMessage
+	err := h.queries.InTx(ctx, func(q *db.Queries) error {
+		parent, err := activeLeaf(ctx, q, thread.Uuid)
+		if err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to load history", err)
+		}
+		msg, err = q.CreateChatMessage(ctx, db.CreateChatMessageParams{
+			Uuid:       pgUUID(uuid.New()),
+			ThreadUuid: thread.Uuid,
+			Role:       "assistant",
+			Content:    content,
+			Emotion:    pgText(name),
+			Language:   pgText(lang.Detect(content).Code),
+			ParentUuid: parent,
+			Author:     pgText("human"),
+		})
+		if err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		if err := q.SetActiveMessage(ctx, db.SetActiveMessageParams{
+			ActiveUuid: msg.Uuid,
+			ThreadUuid: thread.Uuid,
+			ParentUuid: parent,
+		}); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to activate message", err)
+		}
+		if err := q.TouchChatThread(ctx, thread.Uuid); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		// A visitor message whose AI reply failed is answered now.
+		if err := q.MarkChatMessageSent(ctx, parent); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "failed to store message")
+		return
+	}
+
+	publishMessage(ctx, h.events, uuid.UUID(thread.Uuid.Bytes), msg.Uuid)
+	c.JSON(http.StatusCreated, toMessageResponse(msg, nil))
+}
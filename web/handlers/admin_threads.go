@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models/db"
+)
+
+const maxFlagReasonLength = 500
+
+type adminThreadResponse struct {
+	ID                 string     `json:"id"`
+	VisitorID          string     `json:"visitor_id,omitempty"`
+	Title              *string    `json:"title"`
+	Tags               []string   `json:"tags"`
+	MessageCount       int64      `json:"message_count"`
+	UserMessageCount   *int64     `json:"user_message_count,omitempty"`
+	FailedMessageCount *int64     `json:"failed_message_count,omitempty"`
+	FeedbackUp         *int64     `json:"feedback_up,omitempty"`
+	FeedbackDown       *int64     `json:"feedback_down,omitempty"`
+	Flagged            bool       `json:"flagged"`
+	FlaggedAt          *time.Time `json:"flagged_at,omitempty"`
+	FlagReason         string     `json:"flag_reason,omitempty"`
+	TakenOver          bool       `json:"taken_over"`
+	TakenOverAt        *time.Time `json:"taken_over_at,omitempty"`
+	ArchivedAt         *time.Time `json:"archived_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	LastActivityAt     time.Time  `json:"last_activity_at"`
+}
+
+type adminMessageResponse struct {
+	messageResponse
+	Active        bool                    `json:"active"`
+	Model         string                  `json:"model,omitempty"`
+	PromptVersion string                  `json:"prompt_version,omitempty"`
+	Feedback      []adminFeedbackResponse `json:"feedback,omitempty"`
+}
+
+type adminFeedbackResponse struct {
+	Rating    string    `json:"rating"`
+	Reason    string    `json:"reason,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type flagThreadRequest struct {
+	Reason string `json:"reason"`
+}
+
+// HandleListThreads lists all threads, most recently active first, with
+// their labels and message and feedback counts. ?tag=, ?visitor_id= and
+// ?flagged=true narrow the list.
+func (h *AdminHandler) HandleListThreads(c *gin.Context) {
+	pageSize, err := parsePageSize(c, defaultThreadPageSize, maxThreadPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	flagged, err := strconv.ParseBool(c.DefaultQuery("flagged", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "flagged must be true or false"})
+		return
+	}
+	params := db.ListThreadsParams{
+		Tag:         pgText(strings.ToLower(c.Query("tag"))),
+		FlaggedOnly: flagged,
+		PageSize:    int32(pageSize + 1),
+	}
+	if raw := c.Query("visitor_id"); raw != "" {
+		visitorUUID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visitor_id"})
+			return
+		}
+		params.VisitorUuid = pgUUID(visitorUUID)
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		params.CursorActivity, params.CursorUuid, err = decodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	rows, err := h.queries.ListThreads(c.Request.Context(), params)
+	if err != nil {
+		log.Printf("admin list threads error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load threads"})
+		return
+	}
+	var nextCursor string
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		nextCursor = encodeCursor(last.LastActivityAt, last.Uuid)
+	}
+	threads := make([]adminThreadResponse, 0, len(rows))
+	for _, row := range rows {
+		resp := toAdminThreadResponse(db.ChatThread{
+			Uuid:           row.Uuid,
+			VisitorUuid:    row.VisitorUuid,
+			Title:          row.Title,
+			Tags:           row.Tags,
+			CreatedAt:      row.CreatedAt,
+			LastActivityAt: row.LastActivityAt,
+			ArchivedAt:     row.ArchivedAt,
+			FlaggedAt:      row.FlaggedAt,
+			FlagReason:     row.FlagReason,
+			TakenOverAt:    row.TakenOverAt,
+		}, row.MessageCount)
+		resp.UserMessageCount = &row.UserMessageCount
+		resp.FailedMessageCount = &row.FailedMessageCount
+		resp.FeedbackUp = &row.FeedbackUp
+		resp.FeedbackDown = &row.FeedbackDown
+		threads = append(threads, resp)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"threads":     threads,
+		"next_cursor": nextCursor,
+	})
+}
+
+// HandleGetThread returns a thread with its visitor, the emotions shown and
+// every message of every branch in chronological order, including the model,
+// prompt version and feedback of replies.
+func (h *AdminHandler) HandleGetThread(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	messages, err := h.queries.GetChatMessagesByThread(ctx, thread.Uuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
+	feedback, err := h.queries.ListThreadFeedback(ctx, thread.Uuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback"})
+		return
+	}
+	emotionRows, err := h.queries.CountThreadEmotions(ctx, thread.Uuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load emotions"})
+		return
+	}
+
+	var visitor *visitorResponse
+	if thread.VisitorUuid.Valid {
+		row, err := h.queries.GetVisitor(ctx, thread.VisitorUuid)
+		if err == nil {
+			resp := toVisitorResponse(row)
+			visitor = &resp
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load visitor"})
+			return
+		}
+	}
+
+	feedbackByMessage := make(map[string][]adminFeedbackResponse, len(feedback))
+	for _, row := range feedback {
+		id := uuidString(row.MessageUuid)
+		feedbackByMessage[id] = append(feedbackByMessage[id], adminFeedbackResponse{
+			Rating:    row.Rating,
+			Reason:    row.Reason.String,
+			Comment:   row.Comment.String,
+			CreatedAt: timeFromPg(row.CreatedAt),
+		})
+	}
+	items := make([]adminMessageResponse, 0, len(messages))
+	for _, msg := range messages {
+		resp := toMessageResponse(msg, nil)
+		items = append(items, adminMessageResponse{
+			messageResponse: resp,
+			Active:          msg.IsActive,
+			Model:           msg.Model.String,
+			PromptVersion:   msg.PromptVersion.String,
+			Feedback:        feedbackByMessage[resp.ID],
+		})
+	}
+	emotions := make(map[string]int64, len(emotionRows))
+	for _, row := range emotionRows {
+		emotions[row.Emotion.String] = row.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"thread":   toAdminThreadResponse(thread, int64(len(messages))),
+		"visitor":  visitor,
+		"emotions": emotions,
+		"messages": items,
+	})
+}
+
+// HandleDeleteThread deletes a thread with its messages and files.
+func (h *AdminHandler) HandleDeleteThread(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	found, err := deleteThread(c.Request.Context(), h.queries, h.store, thread.Uuid)
+	if err != nil {
+		log.Printf("admin delete thread error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete thread"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandleFlagThread marks a thread for review with an optional reason.
+// Flagging again updates the reason and keeps the original time.
+func (h *AdminHandler) HandleFlagThread(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	var req flagThreadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > maxFlagReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is too long"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.queries.FlagChatThread(ctx, db.FlagChatThreadParams{
+		Uuid:       thread.Uuid,
+		FlagReason: pgText(reason),
+	}); err != nil {
+		log.Printf("flag thread error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to flag thread"})
+		return
+	}
+	h.respondThread(c, thread.Uuid)
+}
+
+func (h *AdminHandler) HandleUnflagThread(c *gin.Context) {
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	if err := h.queries.UnflagChatThread(c.Request.Context(), thread.Uuid); err != nil {
+		log.Printf("unflag thread error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unflag thread"})
+		return
+	}
+	h.respondThread(c, thread.Uuid)
+}
+
+// respondThread responds with the thread as stored now.
+func (h *AdminHandler) respondThread(c *gin.Context, threadUUID pgtype.UUID) {
+	ctx := c.Request.Context()
+	thread, err := h.queries.GetChatThread(ctx, threadUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load thread"})
+		return
+	}
+	summary, err := h.queries.GetThreadSummary(ctx, threadUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load thread"})
+		return
+	}
+	c.JSON(http.StatusOK, toAdminThreadResponse(thread, summary.MessageCount))
+}
+
+func (h *AdminHandler) loadThreadParam(c *gin.Context) (db.ChatThread, bool) {
+	threadUUID, err := uuid.Parse(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread_id"})
+		return db.ChatThread{}, false
+	}
+	thread, err := h.queries.GetChatThread(c.Request.Context(), pgUUID(threadUUID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+			return db.ChatThread{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load thread"})
+		return db.ChatThread{}, false
+	}
+	return thread, true
+}
+
+func toAdminThreadResponse(thread db.ChatThread, messageCount int64) adminThreadResponse {
+	resp := adminThreadResponse{
+		ID:             uuidString(thread.Uuid),
+		VisitorID:      uuidString(thread.VisitorUuid),
+		Tags:           nonNilTags(thread.Tags),
+		MessageCount:   messageCount,
+		Flagged:        thread.FlaggedAt.Valid,
+		FlagReason:     thread.FlagReason.String,
+		TakenOver:      thread.TakenOverAt.Valid,
+		CreatedAt:      timeFromPg(thread.CreatedAt),
+		LastActivityAt: timeFromPg(thread.LastActivityAt),
+	}
+	if thread.Title.Valid {
+		title := thread.Title.String
+		resp.Title = &title
+	}
+	if thread.FlaggedAt.Valid {
+		flaggedAt := thread.FlaggedAt.Time
+		resp.FlaggedAt = &flaggedAt
+	}
+	if thread.TakenOverAt.Valid {
+		takenOverAt := thread.TakenOverAt.Time
+		resp.TakenOverAt = &takenOverAt
+	}
+	if thread.ArchivedAt.Valid {
+		archivedAt := thread.ArchivedAt.Time
+		resp.ArchivedAt = &archivedAt
+	}
+	return resp
+}
+
+// HandleRelabelThread labels the thread again from the start of its active
+// branch, replacing its title and tags.
+func (h *AdminHandler) HandleRelabelThread(c *gin.Context) {
+	if h.labeler == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "thread labeling is disabled"})
+		return
+	}
+	thread, ok := h.loadThreadParam(c)
+	if !ok {
+		return
+	}
+	threadUUID := uuid.UUID(thread.Uuid.Bytes)
+
+	ctx := c.Request.Context()
+	messages, err := h.queries.GetActiveBranch(ctx, pgUUID(threadUUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
+	if len(messages) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "thread has no messages"})
+		return
+	}
+
+	labels, err := applyLabels(ctx, h.queries.Queries, h.labeler, pgUUID(threadUUID), messages, true)
+	if err != nil {
+		log.Printf("relabel thread error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to label thread"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"thread_id": threadUUID.String(),
+		"title":     labels.Title,
+		"tags":      labels.Tags,
+	})
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
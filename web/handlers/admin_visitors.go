@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/models/db"
+)
+
+type visitorResponse struct {
+	ID             string    `json:"id"`
+	IPAddress      string    `json:"ip_address"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	AcceptLanguage string    `json:"accept_language,omitempty"`
+	Referer        string    `json:"referer,omitempty"`
+	ThreadCount    *int64    `json:"thread_count,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+}
+
+// likeEscaper escapes the ILIKE wildcards so user_agent matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// HandleListVisitors lists visitors, most recently seen first. ?seen_after=
+// and ?seen_before= take RFC 3339 timestamps or dates, ?ip= matches exactly
+// and ?user_agent= matches any part of the user agent.
+func (h *AdminHandler) HandleListVisitors(c *gin.Context) {
+	pageSize, err := parsePageSize(c, defaultThreadPageSize, maxThreadPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	params := db.ListVisitorsParams{
+		IpAddress: pgText(strings.TrimSpace(c.Query("ip"))),
+		PageSize:  int32(pageSize + 1),
+	}
+	if userAgent := strings.TrimSpace(c.Query("user_agent")); userAgent != "" {
+		params.UserAgent = pgText(likeEscaper.Replace(userAgent))
+	}
+	if params.SeenAfter, err = parseSearchTime(c.Query("seen_after"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seen_after"})
+		return
+	}
+	if params.SeenBefore, err = parseSearchTime(c.Query("seen_before"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seen_before"})
+		return
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		params.CursorSeen, params.CursorUuid, err = decodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	rows, err := h.queries.ListVisitors(c.Request.Context(), params)
+	if err != nil {
+		log.Printf("list visitors error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load visitors"})
+		return
+	}
+	var nextCursor string
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		nextCursor = encodeCursor(last.LastSeenAt, last.Uuid)
+	}
+	visitors := make([]visitorResponse, 0, len(rows))
+	for _, row := range rows {
+		resp := toVisitorResponse(db.Visitor{
+			Uuid:           row.Uuid,
+			IpAddress:      row.IpAddress,
+			UserAgent:      row.UserAgent,
+			AcceptLanguage: row.AcceptLanguage,
+			Referer:        row.Referer,
+			CreatedAt:      row.CreatedAt,
+			LastSeenAt:     row.LastSeenAt,
+		})
+		resp.ThreadCount = &row.ThreadCount
+		visitors = append(visitors, resp)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"visitors":    visitors,
+		"next_cursor": nextCursor,
+	})
+}
+
+func toVisitorResponse(visitor db.Visitor) visitorResponse {
+	return visitorResponse{
+		ID:             uuidString(visitor.Uuid),
+		IPAddress:      visitor.IpAddress,
+		UserAgent:      visitor.UserAgent.String,
+		AcceptLanguage: visitor.AcceptLanguage.String,
+		Referer:        visitor.Referer.String,
+		CreatedAt:      timeFromPg(visitor.CreatedAt),
+		LastSeenAt:     timeFromPg(visitor.LastSeenAt),
+	}
+}
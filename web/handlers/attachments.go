@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/storage"
+)
+
+var allowedImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type attachmentUpload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+type attachmentResponse struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Filename    string `json:"filename,omitempty"`
+	URL         string `json:"url"`
+}
+
+func (h *ChatHandler) HandleGetAttachment(c *gin.Context) {
+	attachmentUUID, err := uuid.Parse(c.Param("attachment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment_id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	attachment, err := h.queries.GetChatAttachment(ctx, pgUUID(attachmentUUID))
+	if err != nil || !h.ownsMessage(c, attachment.MessageUuid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+
+	data, err := h.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+			return
+		}
+		log.Printf("attachment read error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load attachment"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Data(http.StatusOK, attachment.ContentType, data)
+}
+
+func (h *ChatHandler) maxAttachmentBytes() int64 {
+	if h.cfg == nil || h.cfg.AttachmentsMaxBytes <= 0 {
+		return 5 << 20
+	}
+	return h.cfg.AttachmentsMaxBytes
+}
+
+func (h *ChatHandler) maxAttachmentCount() int {
+	if h.cfg == nil || h.cfg.AttachmentsMaxCount <= 0 {
+		return 4
+	}
+	return h.cfg.AttachmentsMaxCount
+}
+
+// readAttachments validates the image files of a multipart request. JSON
+// requests carry no attachments and return nil.
+func (h *ChatHandler) readAttachments(c *gin.Context) ([]attachmentUpload, error) {
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return nil, nil
+	}
+	maxBody := h.maxAttachmentBytes()*int64(h.maxAttachmentCount()) + 1<<20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, errors.New("invalid multipart form")
+	}
+
+	files := form.File["attachments"]
+	if len(files) > h.maxAttachmentCount() {
+		return nil, fmt.Errorf("too many attachments (max %d)", h.maxAttachmentCount())
+	}
+
+	uploads := make([]attachmentUpload, 0, len(files))
+	for _, file := range files {
+		upload, err := h.readAttachment(file)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+func (h *ChatHandler) readAttachment(file *multipart.FileHeader) (attachmentUpload, error) {
+	maxBytes := h.maxAttachmentBytes()
+	if file.Size > maxBytes {
+		return attachmentUpload{}, fmt.Errorf("attachment %q is too large (max %d bytes)", file.Filename, maxBytes)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return attachmentUpload{}, errors.New("invalid attachment")
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return attachmentUpload{}, errors.New("invalid attachment")
+	}
+	if int64(len(data)) > maxBytes {
+		return attachmentUpload{}, fmt.Errorf("attachment %q is too large (max %d bytes)", file.Filename, maxBytes)
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := allowedImageTypes[contentType]; !ok {
+		return attachmentUpload{}, fmt.Errorf("attachment %q is not a supported image", file.Filename)
+	}
+
+	return attachmentUpload{
+		Filename:    filepath.Base(strings.TrimSpace(file.Filename)),
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// saveAttachments stores the uploads and their rows in q's transaction. On
+// error it returns the attachments saved so far, whose objects the caller
+// removes with deleteAttachments when the transaction is rolled back.
+func (h *ChatHandler) saveAttachments(ctx context.Context, q *db.Queries, messageUUID pgtype.UUID, uploads []attachmentUpload) ([]db.ChatAttachment, error) {
+	saved := make([]db.ChatAttachment, 0, len(uploads))
+	for _, upload := range uploads {
+		attachmentUUID := uuid.New()
+		key := "attachments/" + attachmentUUID.String() + allowedImageTypes[upload.ContentType]
+		if err := h.store.Put(ctx, key, upload.ContentType, upload.Data); err != nil {
+			return saved, err
+		}
+		attachment, err := q.CreateChatAttachment(ctx, db.CreateChatAttachmentParams{
+			Uuid:        pgUUID(attachmentUUID),
+			MessageUuid: messageUUID,
+			StorageKey:  key,
+			ContentType: upload.ContentType,
+			SizeBytes:   int64(len(upload.Data)),
+			Filename:    pgText(upload.Filename),
+		})
+		if err != nil {
+			h.deleteAttachments(ctx, []db.ChatAttachment{{StorageKey: key}})
+			return saved, err
+		}
+		saved = append(saved, attachment)
+	}
+	return saved, nil
+}
+
+// deleteAttachments removes the stored objects of attachments whose rows were
+// not committed.
+func (h *ChatHandler) deleteAttachments(ctx context.Context, attachments []db.ChatAttachment) {
+	ctx = context.WithoutCancel(ctx)
+	for _, attachment := range attachments {
+		if err := h.store.Delete(ctx, attachment.StorageKey); err != nil {
+			log.Printf("attachment delete error: %v", err)
+		}
+	}
+}
+
+func (h *ChatHandler) loadAttachments(ctx context.Context, messages []db.ChatMessage) (map[pgtype.UUID][]db.ChatAttachment, error) {
+	ids := make([]pgtype.UUID, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			ids = append(ids, msg.Uuid)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	attachments, err := h.queries.GetChatAttachmentsByMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byMessage := make(map[pgtype.UUID][]db.ChatAttachment, len(attachments))
+	for _, attachment := range attachments {
+		byMessage[attachment.MessageUuid] = append(byMessage[attachment.MessageUuid], attachment)
+	}
+	return byMessage, nil
+}
+
+// loadAIAttachments reads the image bytes for every attachment in the history
+// so they can be forwarded to the model. Unreadable objects are skipped.
+func (h *ChatHandler) loadAIAttachments(ctx context.Context, history []db.ChatMessage) map[pgtype.UUID][]ai.Attachment {
+	byMessage, err := h.loadAttachments(ctx, history)
+	if err != nil {
+		log.Printf("attachment load error: %v", err)
+		return nil
+	}
+
+	result := make(map[pgtype.UUID][]ai.Attachment, len(byMessage))
+	for messageUUID, attachments := range byMessage {
+		for _, attachment := range attachments {
+			data, err := h.store.Get(ctx, attachment.StorageKey)
+			if err != nil {
+				log.Printf("attachment read error: %v", err)
+				continue
+			}
+			result[messageUUID] = append(result[messageUUID], ai.Attachment{
+				ContentType: attachment.ContentType,
+				Data:        data,
+			})
+		}
+	}
+	return result
+}
+
+func toAttachmentResponses(attachments []db.ChatAttachment) []attachmentResponse {
+	if len(attachments) == 0 {
+		return nil
+	}
+	responses := make([]attachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		id := uuidString(attachment.Uuid)
+		filename := ""
+		if attachment.Filename.Valid {
+			filename = attachment.Filename.String
+		}
+		responses = append(responses, attachmentResponse{
+			ID:          id,
+			ContentType: attachment.ContentType,
+			SizeBytes:   attachment.SizeBytes,
+			Filename:    filename,
+			URL:         "/api/v1/chat/attachments/" + id,
+		})
+	}
+	return responses
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"log"
@@ -17,117 +19,232 @@ import (
 
 	"talk-to-ugur-back/ai"
 	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models"
 	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/speech"
+	"talk-to-ugur-back/storage"
+	"talk-to-ugur-back/threadevents"
+	"talk-to-ugur-back/threadlabel"
+	"talk-to-ugur-back/threadlock"
+	"talk-to-ugur-back/web/middleware"
 )
 
 type ChatHandler struct {
-	queries *db.Queries
+	queries *models.Store
 	ai      *ai.Client
+	store   storage.Store
+	stt     speech.Transcriber
+	tts     speech.Synthesizer
+	locker  threadlock.Locker
+	labeler threadlabel.Labeler
+	events  threadevents.Bus
+	auth    *middleware.VisitorAuth
 	cfg     *config.Config
+	policy  lang.Policy
 }
 
-var errInvalidVisitorID = errors.New("invalid visitor_id")
+// requestError is an error returned from a transaction together with the
+// response it should produce.
+type requestError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *requestError) Error() string { return e.message + ": " + e.err.Error() }
+
+func (e *requestError) Unwrap() error { return e.err }
+
+func failRequest(status int, message string, err error) error {
+	return &requestError{status: status, message: message, err: err}
+}
 
-func NewChatHandler(queries *db.Queries, aiClient *ai.Client, cfg *config.Config) *ChatHandler {
+// respondError writes the response for err. Errors that are not a
+// requestError, e.g. a failed commit, respond 500 with fallback.
+func respondError(c *gin.Context, err error, fallback string) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		reqErr = &requestError{status: http.StatusInternalServerError, message: fallback, err: err}
+	}
+	if reqErr.status >= http.StatusInternalServerError {
+		log.Printf("%s: %v", reqErr.message, reqErr.err)
+	}
+	c.JSON(reqErr.status, gin.H{"error": reqErr.message})
+}
+
+func NewChatHandler(queries *models.Store, aiClient *ai.Client, store storage.Store, stt speech.Transcriber, tts speech.Synthesizer, locker threadlock.Locker, labeler threadlabel.Labeler, events threadevents.Bus, auth *middleware.VisitorAuth, cfg *config.Config) *ChatHandler {
 	return &ChatHandler{
 		queries: queries,
 		ai:      aiClient,
+		store:   store,
+		stt:     stt,
+		tts:     tts,
+		locker:  locker,
+		labeler: labeler,
+		events:  events,
+		auth:    auth,
 		cfg:     cfg,
+		policy:  lang.NewPolicy(cfg.AIReplyLanguagePolicy, cfg.AIReplyLanguage, cfg.AIReplyLanguages),
 	}
 }
 
 type sendMessageRequest struct {
-	ThreadID  string `json:"thread_id"`
-	VisitorID string `json:"visitor_id"`
-	Message   string `json:"message" binding:"required"`
+	ThreadID string `json:"thread_id" form:"thread_id"`
+	Message  string `json:"message" form:"message"`
 }
 
 type messageResponse struct {
-	ID        string    `json:"id"`
-	Role      string    `json:"role"`
-	Content   string    `json:"content"`
-	Emotion   *string   `json:"emotion,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               string               `json:"id"`
+	Role             string               `json:"role"`
+	Content          string               `json:"content"`
+	Emotion          *string              `json:"emotion,omitempty"`
+	Language         *string              `json:"language,omitempty"`
+	LanguageMismatch bool                 `json:"language_mismatch,omitempty"`
+	Author           string               `json:"author,omitempty"`
+	ParentID         string               `json:"parent_id,omitempty"`
+	Alternatives     int                  `json:"alternatives,omitempty"`
+	Segments         []ai.Segment         `json:"segments,omitempty"`
+	Attachments      []attachmentResponse `json:"attachments,omitempty"`
+	Audio            *audioResponse       `json:"audio,omitempty"`
+	Status           string               `json:"status"`
+	CreatedAt        time.Time            `json:"created_at"`
 }
 
 type sendMessageResponse struct {
-	VisitorID        string          `json:"visitor_id"`
-	ThreadID         string          `json:"thread_id"`
-	UserMessage      messageResponse `json:"user_message"`
-	AssistantMessage messageResponse `json:"assistant_message"`
+	VisitorID        string           `json:"visitor_id"`
+	ThreadID         string           `json:"thread_id"`
+	UserMessage      messageResponse  `json:"user_message"`
+	AssistantMessage *messageResponse `json:"assistant_message"`
+	// TakenOver is set when a human has taken over the thread, so the
+	// message is not answered by the AI.
+	TakenOver bool `json:"taken_over,omitempty"`
 }
 
 type createVisitorResponse struct {
-	VisitorID string `json:"visitor_id"`
+	VisitorID    string `json:"visitor_id"`
+	VisitorToken string `json:"visitor_token"`
 }
 
 func (h *ChatHandler) HandleSendMessage(c *gin.Context) {
 	var req sendMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	uploads, err := h.readAttachments(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
 
 	message := strings.TrimSpace(req.Message)
-	if message == "" {
+	if message == "" && len(uploads) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
 		return
 	}
 
-	threadUUID, visitorUUID, userMsg, history, ok := h.prepareChat(c, req, message)
+	unlock, ok := h.lockRequestThread(c, req)
 	if !ok {
 		return
 	}
+	defer unlock()
+
+	turn, ok := h.prepareChat(c, req, message, uploads, nil)
+	if !ok {
+		return
+	}
+	if turn.takenOver {
+		h.respondTakenOver(c, turn)
+		return
+	}
+	opts := h.replyOptions(c, turn.visitorUUID, turn.userMsg, turn.history)
 
 	if strings.EqualFold(c.Query("stream"), "true") {
-		h.streamChat(c, threadUUID, visitorUUID, userMsg, history)
+		h.streamChat(c, turn.threadUUID, turn.visitorUUID, turn.userMsg, turn.attachments, turn.history, opts)
 		return
 	}
 
-	aiReply, err := h.ai.GenerateReply(c.Request.Context(), history)
+	aiReply, err := h.ai.GenerateReply(c.Request.Context(), turn.history, opts)
 	if err != nil {
+		h.markFailed(c.Request.Context(), turn.userMsg.Uuid)
 		c.JSON(http.StatusBadGateway, gin.H{"error": "ai request failed"})
 		log.Printf("ai error: %v", err)
 		return
 	}
 
-	assistantMsg, err := h.queries.CreateChatMessage(c.Request.Context(), db.CreateChatMessageParams{
-		Uuid:       pgUUID(uuid.New()),
-		ThreadUuid: pgUUID(threadUUID),
-		Role:       "assistant",
-		Content:    aiReply.Text,
-		Emotion:    pgText(aiReply.Emotion),
-	})
+	assistantMsg, err := h.storeReply(c.Request.Context(), turn.threadUUID, turn.userMsg.Uuid, aiReply)
 	if err != nil {
+		h.markFailed(c.Request.Context(), turn.userMsg.Uuid)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store assistant message"})
 		return
 	}
 
+	assistant := toMessageResponse(assistantMsg, nil)
+	resp := sendMessageResponse{
+		VisitorID:        uuidOrEmpty(turn.visitorUUID),
+		ThreadID:         turn.threadUUID.String(),
+		UserMessage:      toMessageResponse(turn.userMsg, turn.attachments),
+		AssistantMessage: &assistant,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondTakenOver answers a message sent while a human has taken over the
+// thread. There is no reply yet; it arrives through the thread's events or a
+// long poll of its messages. Streaming requests get the meta and done events
+// right away.
+func (h *ChatHandler) respondTakenOver(c *gin.Context, turn chatTurn) {
 	resp := sendMessageResponse{
-		VisitorID:        uuidOrEmpty(visitorUUID),
-		ThreadID:         threadUUID.String(),
-		UserMessage:      toMessageResponse(userMsg),
-		AssistantMessage: toMessageResponse(assistantMsg),
+		VisitorID:   uuidOrEmpty(turn.visitorUUID),
+		ThreadID:    turn.threadUUID.String(),
+		UserMessage: toMessageResponse(turn.userMsg, turn.attachments),
+		TakenOver:   true,
 	}
-	if resp.VisitorID != "" {
-		setVisitorCookie(c, resp.VisitorID)
-		c.Header("X-Visitor-Id", resp.VisitorID)
+	if !strings.EqualFold(c.Query("stream"), "true") {
+		c.JSON(http.StatusOK, resp)
+		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	stream := newSSEStream(c)
+	if err := stream.writeJSON("meta", gin.H{
+		"visitor_id":   resp.VisitorID,
+		"thread_id":    resp.ThreadID,
+		"user_message": resp.UserMessage,
+		"emotion":      "",
+	}); err != nil {
+		log.Printf("sse meta error: %v", err)
+		return
+	}
+	_ = stream.writeJSON("done", gin.H{
+		"assistant_message": nil,
+		"taken_over":        true,
+	})
 }
 
+// HandleCreateVisitor issues a visitor token. A request that already carries
+// a valid token keeps its visitor and gets a fresh token for it.
 func (h *ChatHandler) HandleCreateVisitor(c *gin.Context) {
 	ctx := c.Request.Context()
-	visitorUUID, err := h.resolveVisitor(ctx, c, "")
+	visitorUUID, err := h.auth.Lookup(c)
+	if err != nil {
+		visitorUUID = uuid.Nil
+	}
+	visitorUUID, err = h.resolveVisitor(ctx, h.queries.Queries, c, visitorUUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		visitorUUID, err = h.resolveVisitor(ctx, h.queries.Queries, c, uuid.Nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create visitor"})
 		return
 	}
-	setVisitorCookie(c, visitorUUID.String())
-	c.Header("X-Visitor-Id", visitorUUID.String())
+	token := h.auth.Issue(c, visitorUUID)
 	c.JSON(http.StatusOK, createVisitorResponse{
-		VisitorID: visitorUUID.String(),
+		VisitorID:    visitorUUID.String(),
+		VisitorToken: token,
 	})
 }
 
@@ -141,45 +258,253 @@ func (h *ChatHandler) HandleGetMessages(c *gin.Context) {
 
 	ctx := c.Request.Context()
 	thread, err := h.queries.GetChatThread(ctx, pgUUID(threadUUID))
-	if err != nil {
+	if err != nil || !ownsThread(c, thread) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
 		return
 	}
-	if thread.VisitorUuid.Valid {
-		h.touchVisitor(ctx, thread.VisitorUuid, c)
+	h.touchVisitor(ctx, thread.VisitorUuid, c)
+
+	view := strings.ToLower(c.DefaultQuery("view", "branch"))
+	if view != "branch" && view != "tree" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view must be branch or tree"})
+		return
+	}
+
+	page, err := parseMessagePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wait, err := parseWait(c.Query("wait"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if wait > 0 && (view != "branch" || !page.after.Valid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wait requires the branch view and an after cursor"})
+		return
+	}
+	var events <-chan threadevents.Event
+	if wait > 0 {
+		// Subscribe before querying, so a message stored in between still
+		// ends the wait.
+		var unsubscribe func()
+		events, unsubscribe = h.events.Subscribe(threadUUID)
+		defer unsubscribe()
 	}
 
-	limit := parseLimit(c.Query("limit"))
 	var messages []db.ChatMessage
-	if limit > 0 {
-		messages, err = h.queries.GetChatMessagesByThreadLimit(ctx, db.GetChatMessagesByThreadLimitParams{
+	var prevCursor, nextCursor string
+	switch {
+	case view == "tree":
+		messages, err = h.queries.GetChatMessagesByThread(ctx, pgUUID(threadUUID))
+	case page.after.Valid:
+		// One extra row tells whether there are newer messages.
+		params := db.GetActiveBranchAfterParams{
+			ThreadUuid: pgUUID(threadUUID),
+			CursorTime: page.after,
+			CursorUuid: page.afterUUID,
+			PageSize:   int32(page.limit + 1),
+		}
+		messages, err = h.queries.GetActiveBranchAfter(ctx, params)
+		if err == nil && len(messages) == 0 && waitForEvent(ctx, events, wait) {
+			messages, err = h.queries.GetActiveBranchAfter(ctx, params)
+			if err == nil {
+				thread, err = h.queries.GetChatThread(ctx, pgUUID(threadUUID))
+			}
+		}
+		if len(messages) > page.limit {
+			messages = messages[:page.limit]
+			nextCursor = messageCursor(messages[len(messages)-1])
+		}
+		if len(messages) > 0 {
+			prevCursor = messageCursor(messages[0])
+		}
+	case page.limit > 0:
+		messages, err = h.queries.GetActiveBranchBefore(ctx, db.GetActiveBranchBeforeParams{
 			ThreadUuid: pgUUID(threadUUID),
-			Limit:      int32(limit),
+			CursorTime: page.before,
+			CursorUuid: page.beforeUUID,
+			PageSize:   int32(page.limit + 1),
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
-			return
+		if len(messages) > page.limit {
+			messages = messages[:page.limit]
+			prevCursor = messageCursor(messages[len(messages)-1])
 		}
 		reverseMessages(messages)
-	} else {
-		messages, err = h.queries.GetChatMessagesByThread(ctx, pgUUID(threadUUID))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
-			return
+		if page.before.Valid && len(messages) > 0 {
+			nextCursor = messageCursor(messages[len(messages)-1])
 		}
+	default:
+		messages, err = h.queries.GetActiveBranch(ctx, pgUUID(threadUUID))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
+	}
+
+	attachments, err := h.loadAttachments(ctx, messages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load attachments"})
+		return
+	}
+	audio, err := h.loadAudio(ctx, messages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load audio"})
+		return
+	}
+
+	alternatives, err := h.countAlternatives(ctx, pgUUID(threadUUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		return
 	}
 
+	responses := make(map[pgtype.UUID]messageResponse, len(messages))
 	responseMessages := make([]messageResponse, 0, len(messages))
 	for _, msg := range messages {
-		responseMessages = append(responseMessages, toMessageResponse(msg))
+		resp := toMessageResponse(msg, attachments[msg.Uuid])
+		if item, ok := audio[msg.Uuid]; ok {
+			resp.Audio = toAudioResponse(&item)
+		}
+		if count := alternatives[msg.ParentUuid]; count > 1 {
+			resp.Alternatives = count
+		}
+		responses[msg.Uuid] = resp
+		responseMessages = append(responseMessages, resp)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"thread_id": threadUUID.String(),
-		"messages":  responseMessages,
+	if view == "tree" {
+		writeWithETag(c, gin.H{
+			"thread_id":  threadUUID.String(),
+			"view":       view,
+			"taken_over": thread.TakenOverAt.Valid,
+			"messages":   buildMessageTree(messages, responses),
+		})
+		return
+	}
+	// last_cursor is what a long poll for newer messages passes as after.
+	lastCursor := c.Query("after")
+	if len(messages) > 0 {
+		lastCursor = messageCursor(messages[len(messages)-1])
+	}
+	writeWithETag(c, gin.H{
+		"thread_id":   threadUUID.String(),
+		"view":        view,
+		"taken_over":  thread.TakenOverAt.Valid,
+		"messages":    responseMessages,
+		"prev_cursor": prevCursor,
+		"next_cursor": nextCursor,
+		"last_cursor": lastCursor,
 	})
 }
 
+// messagePage is the part of the active branch a request asks for. A zero
+// limit without cursors means the whole branch.
+type messagePage struct {
+	limit      int
+	before     pgtype.Timestamptz
+	beforeUUID pgtype.UUID
+	after      pgtype.Timestamptz
+	afterUUID  pgtype.UUID
+}
+
+func parseMessagePage(c *gin.Context) (messagePage, error) {
+	page := messagePage{limit: parseLimit(c.Query("limit"))}
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		return messagePage{}, errors.New("before and after cannot be combined")
+	}
+	var err error
+	if before != "" {
+		if page.before, page.beforeUUID, err = decodeCursor(before); err != nil {
+			return messagePage{}, errors.New("invalid before cursor")
+		}
+	}
+	if after != "" {
+		if page.after, page.afterUUID, err = decodeCursor(after); err != nil {
+			return messagePage{}, errors.New("invalid after cursor")
+		}
+	}
+	if page.limit == 0 && (before != "" || after != "") {
+		page.limit = defaultMessagePageSize
+	}
+	return page, nil
+}
+
+// maxWaitSeconds caps how long a long poll of a thread's messages waits.
+const maxWaitSeconds = 60
+
+// parseWait reads the wait parameter of a long poll in seconds.
+func parseWait(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, errors.New("invalid wait")
+	}
+	return time.Duration(min(seconds, maxWaitSeconds)) * time.Second, nil
+}
+
+// waitForEvent waits up to wait for an event of the thread and reports
+// whether one arrived.
+func waitForEvent(ctx context.Context, events <-chan threadevents.Event, wait time.Duration) bool {
+	if events == nil || wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-events:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func messageCursor(msg db.ChatMessage) string {
+	return encodeCursor(msg.CreatedAt, msg.Uuid)
+}
+
+// writeWithETag responds with body and an ETag of it, or with 304 when the
+// client already has this version.
+func writeWithETag(c *gin.Context, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode response"})
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ChatHandler) heartbeatInterval() time.Duration {
+	if h.cfg == nil {
+		return 0
+	}
+	return time.Duration(h.cfg.AIStreamHeartbeatSeconds) * time.Second
+}
+
 func (h *ChatHandler) maxHistoryLimit() int {
 	if h.cfg == nil || h.cfg.AIMaxHistory <= 0 {
 		return 20
@@ -187,6 +512,9 @@ func (h *ChatHandler) maxHistoryLimit() int {
 	return h.cfg.AIMaxHistory
 }
 
+// defaultMessagePageSize is the page size of cursor requests without limit.
+const defaultMessagePageSize = 50
+
 func parseLimit(raw string) int {
 	if raw == "" {
 		return 0
@@ -207,18 +535,34 @@ func reverseMessages(messages []db.ChatMessage) {
 	}
 }
 
-func toMessageResponse(msg db.ChatMessage) messageResponse {
+func toMessageResponse(msg db.ChatMessage, attachments []db.ChatAttachment) messageResponse {
 	var emotion *string
 	if msg.Emotion.Valid {
 		value := msg.Emotion.String
 		emotion = &value
 	}
+	var language *string
+	if msg.Language.Valid {
+		value := msg.Language.String
+		language = &value
+	}
+	var segments []ai.Segment
+	if len(msg.Segments) > 0 {
+		_ = json.Unmarshal(msg.Segments, &segments)
+	}
 	return messageResponse{
-		ID:        uuidString(msg.Uuid),
-		Role:      msg.Role,
-		Content:   msg.Content,
-		Emotion:   emotion,
-		CreatedAt: timeFromPg(msg.CreatedAt),
+		ID:               uuidString(msg.Uuid),
+		Role:             msg.Role,
+		Content:          msg.Content,
+		Emotion:          emotion,
+		Language:         language,
+		LanguageMismatch: msg.LanguageMismatch,
+		Author:           msg.Author.String,
+		ParentID:         uuidString(msg.ParentUuid),
+		Segments:         segments,
+		Attachments:      toAttachmentResponses(attachments),
+		Status:           msg.Status,
+		CreatedAt:        timeFromPg(msg.CreatedAt),
 	}
 }
 
@@ -254,107 +598,315 @@ func uuidOrEmpty(id uuid.UUID) string {
 	return id.String()
 }
 
-func setVisitorCookie(c *gin.Context, visitorID string) {
-	const maxAgeSeconds = 60 * 60 * 24 * 30
-	c.SetCookie("visitor_id", visitorID, maxAgeSeconds, "/", "", false, false)
+// ownsThread reports whether thread belongs to the visitor of the request.
+// Other visitors' threads are answered as if they did not exist.
+func ownsThread(c *gin.Context, thread db.ChatThread) bool {
+	return thread.VisitorUuid.Valid && uuid.UUID(thread.VisitorUuid.Bytes) == middleware.VisitorID(c)
+}
+
+// ownsMessage reports whether the message belongs to a thread of the visitor
+// of the request.
+func (h *ChatHandler) ownsMessage(c *gin.Context, messageUUID pgtype.UUID) bool {
+	ctx := c.Request.Context()
+	msg, err := h.queries.GetChatMessage(ctx, messageUUID)
+	if err != nil {
+		return false
+	}
+	thread, err := h.queries.GetChatThread(ctx, msg.ThreadUuid)
+	return err == nil && ownsThread(c, thread)
+}
+
+// lockThread waits until no other message of the thread is being answered
+// and responds with 409 if it stays busy.
+func (h *ChatHandler) lockThread(c *gin.Context, threadUUID uuid.UUID) (func(), bool) {
+	return lockThread(c, h.locker, threadUUID)
 }
 
-func (h *ChatHandler) prepareChat(c *gin.Context, req sendMessageRequest, message string) (uuid.UUID, uuid.UUID, db.ChatMessage, []db.ChatMessage, bool) {
+func lockThread(c *gin.Context, locker threadlock.Locker, threadUUID uuid.UUID) (func(), bool) {
+	if locker == nil {
+		return func() {}, true
+	}
+	unlock, err := locker.Lock(c.Request.Context(), threadUUID)
+	if err != nil {
+		if errors.Is(err, threadlock.ErrBusy) {
+			c.JSON(http.StatusConflict, gin.H{"error": "thread is busy"})
+			return nil, false
+		}
+		log.Printf("thread lock error: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to lock thread"})
+		return nil, false
+	}
+	return unlock, true
+}
+
+// lockRequestThread locks the thread a message is sent to. New threads need
+// no lock, and invalid thread ids are left to prepareChat.
+func (h *ChatHandler) lockRequestThread(c *gin.Context, req sendMessageRequest) (func(), bool) {
+	threadUUID, err := uuid.Parse(req.ThreadID)
+	if req.ThreadID == "" || err != nil {
+		return func() {}, true
+	}
+	return h.lockThread(c, threadUUID)
+}
+
+// chatTurn is a stored user message with everything needed to answer it.
+type chatTurn struct {
+	threadUUID  uuid.UUID
+	visitorUUID uuid.UUID
+	userMsg     db.ChatMessage
+	attachments []db.ChatAttachment
+	audio       *db.ChatMessageAudio
+	history     []db.ChatMessage
+	// takenOver is set when a human has taken over the thread and the
+	// message must not be answered by the AI.
+	takenOver bool
+}
+
+// prepareChat stores the user message with its attachments or recording,
+// creating the visitor and the thread if needed, and loads the history to
+// answer it. It all happens in one transaction, so a failure leaves nothing
+// behind. While a human has taken over the thread there is nothing to answer
+// and no history is loaded.
+func (h *ChatHandler) prepareChat(c *gin.Context, req sendMessageRequest, message string, uploads []attachmentUpload, audio *speech.Audio) (chatTurn, bool) {
 	ctx := c.Request.Context()
-	var threadUUID uuid.UUID
-	var visitorUUID uuid.UUID
-	if req.ThreadID == "" {
+	var turn chatTurn
+	if req.ThreadID != "" {
 		var err error
-		visitorUUID, err = h.resolveVisitor(ctx, c, req.VisitorID)
+		turn.threadUUID, err = uuid.Parse(req.ThreadID)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "visitor not found"})
-				return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread_id"})
+			return chatTurn{}, false
+		}
+	}
+
+	var threadVisitor pgtype.UUID
+	err := h.queries.InTx(ctx, func(q *db.Queries) error {
+		if req.ThreadID == "" {
+			visitorUUID, err := h.resolveVisitor(ctx, q, c, middleware.VisitorID(c))
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return failRequest(http.StatusUnauthorized, "unknown visitor", err)
+				}
+				return failRequest(http.StatusInternalServerError, "failed to load visitor", err)
+			}
+			turn.visitorUUID = visitorUUID
+			turn.threadUUID = uuid.New()
+			if _, err := q.CreateChatThread(ctx, db.CreateChatThreadParams{
+				Uuid:        pgUUID(turn.threadUUID),
+				VisitorUuid: pgUUID(turn.visitorUUID),
+			}); err != nil {
+				return failRequest(http.StatusInternalServerError, "failed to create thread", err)
 			}
-			if errors.Is(err, errInvalidVisitorID) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visitor_id"})
-				return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+		} else {
+			thread, err := q.GetChatThread(ctx, pgUUID(turn.threadUUID))
+			if err != nil {
+				return failRequest(http.StatusNotFound, "thread not found", err)
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create visitor"})
-			return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+			if !ownsThread(c, thread) {
+				return failRequest(http.StatusNotFound, "thread not found", pgx.ErrNoRows)
+			}
+			threadVisitor = thread.VisitorUuid
+			turn.visitorUUID = uuid.UUID(thread.VisitorUuid.Bytes)
+			turn.takenOver = thread.TakenOverAt.Valid
 		}
-		threadUUID = uuid.New()
-		_, err = h.queries.CreateChatThread(ctx, db.CreateChatThreadParams{
-			Uuid:        pgUUID(threadUUID),
-			VisitorUuid: pgUUID(visitorUUID),
-		})
+
+		parent, err := activeLeaf(ctx, q, pgUUID(turn.threadUUID))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create thread"})
-			return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+			return failRequest(http.StatusInternalServerError, "failed to load history", err)
 		}
-	} else {
-		var err error
-		threadUUID, err = uuid.Parse(req.ThreadID)
+		turn.userMsg, err = q.CreateChatMessage(ctx, db.CreateChatMessageParams{
+			Uuid:       pgUUID(uuid.New()),
+			ThreadUuid: pgUUID(turn.threadUUID),
+			Role:       "user",
+			Content:    message,
+			Emotion:    pgtype.Text{},
+			Language:   pgText(lang.Detect(message).Code),
+			ParentUuid: parent,
+		})
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread_id"})
-			return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		if err := q.TouchChatThread(ctx, pgUUID(turn.threadUUID)); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
 		}
-		thread, err := h.queries.GetChatThread(ctx, pgUUID(threadUUID))
+		turn.attachments, err = h.saveAttachments(ctx, q, turn.userMsg.Uuid, uploads)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
-			return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+			return failRequest(http.StatusInternalServerError, "failed to store attachments", err)
+		}
+		if audio != nil {
+			if turn.audio, err = h.saveAudio(ctx, q, turn.userMsg.Uuid, *audio); err != nil {
+				return failRequest(http.StatusInternalServerError, "failed to store audio", err)
+			}
 		}
-		if thread.VisitorUuid.Valid {
-			h.touchVisitor(ctx, thread.VisitorUuid, c)
-			visitorUUID = uuid.UUID(thread.VisitorUuid.Bytes)
+		if turn.takenOver {
+			return nil
+		}
+		turn.history, err = h.loadPath(ctx, q, turn.userMsg.Uuid)
+		if err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to load history", err)
 		}
+		return nil
+	})
+	if err != nil {
+		h.deleteAttachments(ctx, turn.attachments)
+		h.deleteAudio(ctx, turn.audio)
+		respondError(c, err, "failed to store message")
+		return chatTurn{}, false
 	}
 
-	userMsg, err := h.queries.CreateChatMessage(ctx, db.CreateChatMessageParams{
-		Uuid:       pgUUID(uuid.New()),
-		ThreadUuid: pgUUID(threadUUID),
-		Role:       "user",
-		Content:    message,
-		Emotion:    pgtype.Text{},
+	h.touchVisitor(ctx, threadVisitor, c)
+	publishMessage(ctx, h.events, turn.threadUUID, turn.userMsg.Uuid)
+	return turn, true
+}
+
+// storeReply saves an assistant reply to userMsgUUID, makes it the active
+// child of that message and clears the message's failed status.
+func (h *ChatHandler) storeReply(ctx context.Context, threadUUID uuid.UUID, userMsgUUID pgtype.UUID, aiReply ai.Reply) (db.ChatMessage, error) {
+	var segments []byte
+	if len(aiReply.Segments) > 0 {
+		var err error
+		if segments, err = json.Marshal(aiReply.Segments); err != nil {
+			return db.ChatMessage{}, err
+		}
+	}
+	var assistantMsg db.ChatMessage
+	err := h.queries.InTx(ctx, func(q *db.Queries) error {
+		var err error
+		assistantMsg, err = q.CreateChatMessage(ctx, db.CreateChatMessageParams{
+			Uuid:             pgUUID(uuid.New()),
+			ThreadUuid:       pgUUID(threadUUID),
+			Role:             "assistant",
+			Content:          aiReply.Text,
+			Emotion:          pgText(aiReply.Emotion),
+			Language:         pgText(aiReply.Language),
+			ParentUuid:       userMsgUUID,
+			Segments:         segments,
+			Model:            pgText(aiReply.Model),
+			PromptVersion:    pgText(aiReply.PromptVersion),
+			Author:           pgText("ai"),
+			LanguageMismatch: aiReply.LanguageMismatch,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.SetActiveMessage(ctx, db.SetActiveMessageParams{
+			ActiveUuid: assistantMsg.Uuid,
+			ThreadUuid: pgUUID(threadUUID),
+			ParentUuid: userMsgUUID,
+		}); err != nil {
+			return err
+		}
+		if err := q.TouchChatThread(ctx, pgUUID(threadUUID)); err != nil {
+			return err
+		}
+		return q.MarkChatMessageSent(ctx, userMsgUUID)
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store message"})
-		return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+		return db.ChatMessage{}, err
+	}
+	h.savePrompt(ctx, assistantMsg.Uuid, aiReply.Prompt)
+	h.labelThread(threadUUID, assistantMsg.Uuid)
+	publishMessage(ctx, h.events, threadUUID, assistantMsg.Uuid)
+	return assistantMsg, nil
+}
+
+// markFailed flags a user message whose reply could not be generated or
+// stored. Messages that already have a reply keep their status.
+func (h *ChatHandler) markFailed(ctx context.Context, userMsgUUID pgtype.UUID) {
+	if err := h.queries.MarkChatMessageFailed(context.WithoutCancel(ctx), userMsgUUID); err != nil {
+		log.Printf("mark failed error: %v", err)
 	}
+}
 
-	history, err := h.queries.GetChatMessagesByThreadLimit(ctx, db.GetChatMessagesByThreadLimitParams{
-		ThreadUuid: pgUUID(threadUUID),
-		Limit:      int32(h.maxHistoryLimit()),
+// savePrompt records the request behind an assistant message. Capture is a
+// debugging aid, so failures are only logged.
+func (h *ChatHandler) savePrompt(ctx context.Context, messageUUID pgtype.UUID, prompt *ai.Prompt) {
+	if prompt == nil {
+		return
+	}
+	_, err := h.queries.CreateChatPrompt(ctx, db.CreateChatPromptParams{
+		Uuid:             pgUUID(uuid.New()),
+		MessageUuid:      messageUUID,
+		Model:            prompt.Model,
+		Temperature:      prompt.Temperature,
+		ResponseFormat:   prompt.ResponseFormat,
+		SystemPrompt:     prompt.SystemPrompt,
+		SystemPromptHash: prompt.SystemPromptHash,
+		HistoryUuids:     prompt.HistoryIDs,
+		Request:          prompt.Request,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load history"})
-		return uuid.UUID{}, uuid.UUID{}, db.ChatMessage{}, nil, false
+		log.Printf("prompt capture error: %v", err)
 	}
+}
 
-	reverseMessages(history)
+func (h *ChatHandler) replyOptions(c *gin.Context, visitorUUID uuid.UUID, userMsg db.ChatMessage, history []db.ChatMessage) ai.ReplyOptions {
+	ctx := c.Request.Context()
+	return ai.ReplyOptions{
+		Attachments: h.loadAIAttachments(ctx, history),
+		Language:    h.policy.Resolve(userMsg.Language.String, h.acceptLanguages(ctx, c, visitorUUID)),
+	}
+}
 
-	return threadUUID, visitorUUID, userMsg, history, true
+// acceptLanguages prefers the live request header and falls back to the one
+// recorded for the visitor, e.g. for API clients that do not send it.
+func (h *ChatHandler) acceptLanguages(ctx context.Context, c *gin.Context, visitorUUID uuid.UUID) []string {
+	if header := strings.TrimSpace(c.GetHeader("Accept-Language")); header != "" {
+		return lang.ParseAcceptLanguage(header)
+	}
+	if visitorUUID == uuid.Nil {
+		return nil
+	}
+	visitor, err := h.queries.GetVisitor(ctx, pgUUID(visitorUUID))
+	if err != nil || !visitor.AcceptLanguage.Valid {
+		return nil
+	}
+	return lang.ParseAcceptLanguage(visitor.AcceptLanguage.String)
 }
 
-func (h *ChatHandler) streamChat(c *gin.Context, threadUUID uuid.UUID, visitorUUID uuid.UUID, userMsg db.ChatMessage, history []db.ChatMessage) {
+func (h *ChatHandler) streamChat(c *gin.Context, threadUUID uuid.UUID, visitorUUID uuid.UUID, userMsg db.ChatMessage, userAttachments []db.ChatAttachment, history []db.ChatMessage, opts ai.ReplyOptions) {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
 	visitorID := uuidOrEmpty(visitorUUID)
-	if visitorID != "" {
-		setVisitorCookie(c, visitorID)
-		c.Header("X-Visitor-Id", visitorID)
-	}
 
+	replied := false
+	defer func() {
+		if !replied {
+			h.markFailed(c.Request.Context(), userMsg.Uuid)
+		}
+	}()
+
+	stream := newSSEStream(c)
+	stopHeartbeat := stream.heartbeat(h.heartbeatInterval())
+	defer stopHeartbeat()
+	ctx, firstToken, cancel := h.streamContext(c.Request.Context())
+	defer cancel()
+
+	sink := h.newSink(stream)
 	metaSent := false
 	var buffered strings.Builder
 	sendMeta := func(emotion string) error {
 		meta := gin.H{
 			"visitor_id":   visitorID,
 			"thread_id":    threadUUID.String(),
-			"user_message": toMessageResponse(userMsg),
+			"user_message": toMessageResponse(userMsg, userAttachments),
 			"emotion":      emotion,
 		}
-		return writeSSE(c, "meta", meta)
+		return sink.Send("meta", meta)
+	}
+
+	if h.ai.SegmentsEnabled() {
+		aiReply, ok := h.streamSegments(ctx, stream, sink, firstToken, history, opts, sendMeta)
+		if ok {
+			replied = h.finishStream(c, stream, sink, threadUUID, userMsg, opts, aiReply)
+		}
+		return
 	}
 
 	onEmotion := func(emotion string) error {
+		firstToken()
 		if emotion == "" || metaSent {
 			return nil
 		}
@@ -363,7 +915,7 @@ func (h *ChatHandler) streamChat(c *gin.Context, threadUUID uuid.UUID, visitorUU
 		}
 		metaSent = true
 		if buffered.Len() > 0 {
-			if err := writeSSEData(c, "token", buffered.String()); err != nil {
+			if err := sink.Text(buffered.String()); err != nil {
 				return err
 			}
 			buffered.Reset()
@@ -371,58 +923,123 @@ func (h *ChatHandler) streamChat(c *gin.Context, threadUUID uuid.UUID, visitorUU
 		return nil
 	}
 
-	aiReply, err := h.ai.StreamReply(c.Request.Context(), history, func(chunk string) error {
+	aiReply, err := h.ai.StreamReply(ctx, history, opts, func(chunk string) error {
+		firstToken()
 		if !metaSent {
 			buffered.WriteString(chunk)
 			return nil
 		}
-		return writeSSEData(c, "token", chunk)
+		return sink.Text(chunk)
 	}, onEmotion)
 	if err != nil {
 		log.Printf("ai stream error: %v", err)
-		_ = writeSSEData(c, "error", "ai request failed")
+		sink.Stop()
+		stream.writeError(classifyStreamError(ctx, err))
 		return
 	}
 	if !metaSent {
 		if err := sendMeta(aiReply.Emotion); err != nil {
 			log.Printf("sse meta error: %v", err)
+			sink.Stop()
 			return
 		}
 		metaSent = true
 		if buffered.Len() > 0 {
-			if err := writeSSEData(c, "token", buffered.String()); err != nil {
+			if err := sink.Text(buffered.String()); err != nil {
 				log.Printf("sse token error: %v", err)
+				sink.Stop()
 				return
 			}
 			buffered.Reset()
 		}
 	}
 
-	assistantMsg, err := h.queries.CreateChatMessage(c.Request.Context(), db.CreateChatMessageParams{
-		Uuid:       pgUUID(uuid.New()),
-		ThreadUuid: pgUUID(threadUUID),
-		Role:       "assistant",
-		Content:    aiReply.Text,
-		Emotion:    pgText(aiReply.Emotion),
-	})
+	replied = h.finishStream(c, stream, sink, threadUUID, userMsg, opts, aiReply)
+}
+
+// streamSegments streams a multi-segment reply as segment_start, token and
+// segment_end events. meta is sent when the first segment opens.
+func (h *ChatHandler) streamSegments(ctx context.Context, stream *sseStream, sink sseSink, firstToken func(), history []db.ChatMessage, opts ai.ReplyOptions, sendMeta func(string) error) (ai.Reply, bool) {
+	metaSent := false
+	ended, open := 0, -1
+	onStart := func(index int, emotion string) error {
+		open = index
+		firstToken()
+		if !metaSent {
+			if err := sendMeta(emotion); err != nil {
+				return err
+			}
+			metaSent = true
+		}
+		return sink.Send("segment_start", gin.H{"index": index, "emotion": emotion})
+	}
+	onEnd := func(index int, segment ai.Segment) error {
+		ended, open = index+1, -1
+		return sink.Send("segment_end", gin.H{"index": index, "emotion": segment.Emotion, "text": segment.Text})
+	}
+
+	aiReply, err := h.ai.StreamSegments(ctx, history, opts, onStart, sink.Text, onEnd)
 	if err != nil {
-		log.Printf("ai store error: %v", err)
-		_ = writeSSEData(c, "error", "failed to store assistant message")
-		return
+		log.Printf("ai stream error: %v", err)
+		sink.Stop()
+		stream.writeError(classifyStreamError(ctx, err))
+		return ai.Reply{}, false
 	}
 
-	donePayload := gin.H{
-		"assistant_message": toMessageResponse(assistantMsg),
+	// Segments that were not streamed, e.g. because the model answered in
+	// another shape, are sent whole. A segment whose text was streamed but
+	// that never closed only gets its segment_end.
+	for i := ended; i < len(aiReply.Segments); i++ {
+		segment := aiReply.Segments[i]
+		if i != open {
+			if err := onStart(i, segment.Emotion); err != nil {
+				log.Printf("sse segment error: %v", err)
+				sink.Stop()
+				return ai.Reply{}, false
+			}
+			if err := sink.Text(segment.Text); err != nil {
+				log.Printf("sse segment error: %v", err)
+				sink.Stop()
+				return ai.Reply{}, false
+			}
+		}
+		if err := onEnd(i, segment); err != nil {
+			log.Printf("sse segment error: %v", err)
+			sink.Stop()
+			return ai.Reply{}, false
+		}
 	}
-	_ = writeSSE(c, "done", donePayload)
+	return aiReply, true
 }
 
-func writeSSE(c *gin.Context, event string, payload any) error {
-	data, err := json.Marshal(payload)
+// finishStream stores a streamed reply and, once everything queued in sink
+// has been written, sends the done event. Storing does not wait for pacing.
+// It reports whether the reply was stored.
+func (h *ChatHandler) finishStream(c *gin.Context, stream *sseStream, sink sseSink, threadUUID uuid.UUID, userMsg db.ChatMessage, opts ai.ReplyOptions, aiReply ai.Reply) bool {
+	if aiReply.LanguageMismatch {
+		log.Printf("ai reply language mismatch: want=%s got=%s", opts.Language, aiReply.Language)
+	}
+
+	assistantMsg, err := h.storeReply(c.Request.Context(), threadUUID, userMsg.Uuid, aiReply)
 	if err != nil {
-		return err
+		log.Printf("ai store error: %v", err)
+		sink.Stop()
+		stream.writeError(streamError{Code: "store_failed", Message: "failed to store assistant message", Retryable: true})
+		return false
+	}
+	if err := sink.Close(); err != nil {
+		log.Printf("sse write error: %v", err)
+		return true
 	}
-	return writeSSEData(c, event, string(data))
+
+	// meta carries the model's emotion before the text is complete; with
+	// AI_EMOTION_OVERRIDE the stored one may differ, so done repeats it.
+	donePayload := gin.H{
+		"assistant_message": toMessageResponse(assistantMsg, nil),
+		"emotion":           aiReply.Emotion,
+	}
+	_ = stream.writeJSON("done", donePayload)
+	return true
 }
 
 func writeSSEData(c *gin.Context, event, data string) error {
@@ -445,16 +1062,14 @@ func writeSSEData(c *gin.Context, event, data string) error {
 	return nil
 }
 
-func (h *ChatHandler) resolveVisitor(ctx context.Context, c *gin.Context, visitorID string) (uuid.UUID, error) {
+// resolveVisitor records a visit of an existing visitor, or creates a new one
+// for uuid.Nil. Unknown visitors return pgx.ErrNoRows.
+func (h *ChatHandler) resolveVisitor(ctx context.Context, q *db.Queries, c *gin.Context, visitorUUID uuid.UUID) (uuid.UUID, error) {
 	info := captureVisitorInfo(c)
 
-	if strings.TrimSpace(visitorID) != "" {
-		parsed, err := uuid.Parse(visitorID)
-		if err != nil {
-			return uuid.UUID{}, errInvalidVisitorID
-		}
-		_, err = h.queries.UpdateVisitorLastSeen(ctx, db.UpdateVisitorLastSeenParams{
-			Uuid:           pgUUID(parsed),
+	if visitorUUID != uuid.Nil {
+		_, err := q.UpdateVisitorLastSeen(ctx, db.UpdateVisitorLastSeenParams{
+			Uuid:           pgUUID(visitorUUID),
 			IpAddress:      info.IPAddress,
 			UserAgent:      pgText(info.UserAgent),
 			AcceptLanguage: pgText(info.AcceptLanguage),
@@ -466,11 +1081,11 @@ func (h *ChatHandler) resolveVisitor(ctx context.Context, c *gin.Context, visito
 		if err != nil {
 			return uuid.UUID{}, err
 		}
-		return parsed, nil
+		return visitorUUID, nil
 	}
 
-	visitorUUID := uuid.New()
-	_, err := h.queries.CreateVisitor(ctx, db.CreateVisitorParams{
+	visitorUUID = uuid.New()
+	_, err := q.CreateVisitor(ctx, db.CreateVisitorParams{
 		Uuid:           pgUUID(visitorUUID),
 		IpAddress:      info.IPAddress,
 		UserAgent:      pgText(info.UserAgent),
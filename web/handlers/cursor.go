@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Cursors are opaque to clients and point at a row by its
+// (timestamp, uuid) sort key as "<unix nanos>.<uuid>".
+func encodeCursor(ts pgtype.Timestamptz, id pgtype.UUID) string {
+	raw := strconv.FormatInt(ts.Time.UnixNano(), 10) + "." + uuidString(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (pgtype.Timestamptz, pgtype.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pgtype.Timestamptz{}, pgtype.UUID{}, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return pgtype.Timestamptz{}, pgtype.UUID{}, errors.New("malformed cursor")
+	}
+	unixNanos, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return pgtype.Timestamptz{}, pgtype.UUID{}, err
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return pgtype.Timestamptz{}, pgtype.UUID{}, err
+	}
+	return pgtype.Timestamptz{Time: time.Unix(0, unixNanos), Valid: true}, pgUUID(parsed), nil
+}
+
+// parsePageSize reads ?limit=, which defaults to def and is capped at max.
+func parsePageSize(c *gin.Context, def, max int) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return def, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+	return min(size, max), nil
+}
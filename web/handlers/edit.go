@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/lang"
+	"talk-to-ugur-back/models/db"
+)
+
+type editMessageRequest struct {
+	Message string `json:"message"`
+}
+
+type messageNode struct {
+	messageResponse
+	Active   bool          `json:"active"`
+	Children []messageNode `json:"children"`
+}
+
+// HandleEditMessage stores an edited copy of a user message next to the
+// original, which forks the thread at that point, and replies to it. The
+// original message and everything after it stay available as another branch.
+func (h *ChatHandler) HandleEditMessage(c *gin.Context) {
+	original, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+	if original.Role != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only user messages can be edited"})
+		return
+	}
+
+	var req editMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return
+	}
+
+	visitorUUID, ok := h.threadVisitor(c, original.ThreadUuid)
+	if !ok {
+		return
+	}
+	unlock, ok := h.lockThread(c, uuid.UUID(original.ThreadUuid.Bytes))
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	ctx := c.Request.Context()
+	var edited db.ChatMessage
+	err := h.queries.InTx(ctx, func(q *db.Queries) error {
+		// A takeover may have started while this request waited for the lock.
+		thread, err := q.GetChatThread(ctx, original.ThreadUuid)
+		if err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to load thread", err)
+		}
+		if thread.TakenOverAt.Valid {
+			return failRequest(http.StatusConflict, "thread is taken over", errors.New("taken over while waiting for the lock"))
+		}
+		edited, err = q.CreateChatMessage(ctx, db.CreateChatMessageParams{
+			Uuid:       pgUUID(uuid.New()),
+			ThreadUuid: original.ThreadUuid,
+			Role:       "user",
+			Content:    message,
+			Emotion:    pgtype.Text{},
+			Language:   pgText(lang.Detect(message).Code),
+			ParentUuid: original.ParentUuid,
+		})
+		if err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		if err := q.CopyChatAttachments(ctx, db.CopyChatAttachmentsParams{
+			ToMessageUuid:   edited.Uuid,
+			FromMessageUuid: original.Uuid,
+		}); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store attachments", err)
+		}
+		if err := q.ActivateMessagePath(ctx, db.ActivateMessagePathParams{
+			ActiveUuid: edited.Uuid,
+			ThreadUuid: edited.ThreadUuid,
+		}); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to activate message", err)
+		}
+		if err := q.TouchChatThread(ctx, edited.ThreadUuid); err != nil {
+			return failRequest(http.StatusInternalServerError, "failed to store message", err)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "failed to store message")
+		return
+	}
+	publishMessage(ctx, h.events, uuid.UUID(edited.ThreadUuid.Bytes), edited.Uuid)
+
+	h.replyTo(c, uuid.UUID(edited.ThreadUuid.Bytes), visitorUUID, edited)
+}
+
+// activeLeaf returns the last message of the thread's active branch, which
+// new messages are attached to. It is invalid for an empty thread.
+func activeLeaf(ctx context.Context, q *db.Queries, threadUUID pgtype.UUID) (pgtype.UUID, error) {
+	leaf, err := q.GetActiveBranchLimit(ctx, db.GetActiveBranchLimitParams{
+		ThreadUuid: threadUUID,
+		Limit:      1,
+	})
+	if err != nil || len(leaf) == 0 {
+		return pgtype.UUID{}, err
+	}
+	return leaf[0].Uuid, nil
+}
+
+// loadPath returns the most recent messages on the path from the thread root
+// to messageUUID in chronological order, which is the model's history.
+func (h *ChatHandler) loadPath(ctx context.Context, q *db.Queries, messageUUID pgtype.UUID) ([]db.ChatMessage, error) {
+	history, err := q.GetMessagePath(ctx, db.GetMessagePathParams{
+		Uuid:  messageUUID,
+		Limit: int32(h.maxHistoryLimit()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	reverseMessages(history)
+	return history, nil
+}
+
+// buildMessageTree nests messages under their parents. messages must be in
+// chronological order so children keep the order they were written in.
+func buildMessageTree(messages []db.ChatMessage, responses map[pgtype.UUID]messageResponse) []messageNode {
+	children := make(map[pgtype.UUID][]db.ChatMessage, len(messages))
+	for _, msg := range messages {
+		children[msg.ParentUuid] = append(children[msg.ParentUuid], msg)
+	}
+
+	var build func(parent pgtype.UUID) []messageNode
+	build = func(parent pgtype.UUID) []messageNode {
+		nodes := make([]messageNode, 0, len(children[parent]))
+		for _, msg := range children[parent] {
+			nodes = append(nodes, messageNode{
+				messageResponse: responses[msg.Uuid],
+				Active:          msg.IsActive,
+				Children:        build(msg.Uuid),
+			})
+		}
+		return nodes
+	}
+	return build(pgtype.UUID{})
+}
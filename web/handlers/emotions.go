@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
+)
+
+type EmotionHandler struct {
+	catalog  *emotion.Catalog
+	emotions *emotion.Set
+	cfg      *config.Config
+}
+
+func NewEmotionHandler(catalog *emotion.Catalog, emotions *emotion.Set, cfg *config.Config) *EmotionHandler {
+	return &EmotionHandler{
+		catalog:  catalog,
+		emotions: emotions,
+		cfg:      cfg,
+	}
+}
+
+type emotionAssetResponse struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        string `json:"size,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+type emotionManifestEntry struct {
+	Name string `json:"name"`
+	// Uses is set when the emotion has no images of its own and shows the
+	// ones of this emotion instead.
+	Uses   string                 `json:"uses,omitempty"`
+	Assets []emotionAssetResponse `json:"assets"`
+	Frames []emotionAssetResponse `json:"frames,omitempty"`
+}
+
+type emotionManifestResponse struct {
+	Fallback string                 `json:"fallback"`
+	Emotions []emotionManifestEntry `json:"emotions"`
+}
+
+func (h *EmotionHandler) HandleManifest(c *gin.Context) {
+	names := h.emotions.Names()
+	resp := emotionManifestResponse{
+		Fallback: h.cfg.AIEmotionDefaultFallback,
+		Emotions: make([]emotionManifestEntry, 0, len(names)),
+	}
+	for _, name := range names {
+		resolved, err := h.catalog.Resolve(name, h.cfg.AIEmotionFallbacks)
+		if err != nil {
+			continue
+		}
+		entry := emotionManifestEntry{Name: name}
+		if resolved != name {
+			entry.Uses = resolved
+		}
+		variants, frames := h.catalog.Variants(resolved)
+		entry.Assets = toEmotionAssetResponses(variants)
+		if len(frames) > 0 {
+			entry.Frames = toEmotionAssetResponses(frames)
+		}
+		resp.Emotions = append(resp.Emotions, entry)
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleAsset serves emotion images. Hashed names from the manifest never
+// change content and are cached for a year; plain names only briefly.
+func (h *EmotionHandler) HandleAsset(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	asset, hashed, ok := h.catalog.Lookup(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	if hashed {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+	c.Header("Content-Type", asset.ContentType)
+	c.File(asset.Path)
+}
+
+func toEmotionAssetResponses(assets []emotion.Asset) []emotionAssetResponse {
+	out := make([]emotionAssetResponse, 0, len(assets))
+	for _, asset := range assets {
+		out = append(out, emotionAssetResponse{
+			URL:         "/emotions/" + asset.Name,
+			ContentType: asset.ContentType,
+			Size:        asset.Size,
+			Width:       asset.Width,
+			Height:      asset.Height,
+		})
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/threadevents"
+)
+
+// HandleThreadEvents streams a thread's changes as server-sent events until
+// the client disconnects: a takeover event with the current state first, then
+// a message event for every new message and a takeover event whenever a
+// human takes over or hands back. Events are not replayed, so clients that
+// reconnect catch up with GET .../messages?after=.
+func (h *ChatHandler) HandleThreadEvents(c *gin.Context) {
+	threadUUID, ok := h.loadOwnedThread(c)
+	if !ok {
+		return
+	}
+
+	events, unsubscribe := h.events.Subscribe(uuid.UUID(threadUUID.Bytes))
+	defer unsubscribe()
+
+	// The state is read after subscribing, so no change is lost in between.
+	ctx := c.Request.Context()
+	thread, err := h.queries.GetChatThread(ctx, threadUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load thread"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	stream := newSSEStream(c)
+	stopHeartbeat := stream.heartbeat(h.heartbeatInterval())
+	defer stopHeartbeat()
+
+	if err := stream.writeJSON("takeover", takeoverPayload(thread.TakenOverAt)); err != nil {
+		return
+	}
+	for {
+		select {
+		case event := <-events:
+			if err := h.writeThreadEvent(ctx, stream, event); err != nil {
+				log.Printf("thread events error: %v", err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *ChatHandler) writeThreadEvent(ctx context.Context, stream *sseStream, event threadevents.Event) error {
+	switch event.Type {
+	case threadevents.Message:
+		msg, err := h.queries.GetChatMessage(ctx, pgUUID(event.MessageID))
+		if err != nil {
+			return err
+		}
+		attachments, err := h.loadAttachments(ctx, []db.ChatMessage{msg})
+		if err != nil {
+			return err
+		}
+		return stream.writeJSON("message", toMessageResponse(msg, attachments[msg.Uuid]))
+	case threadevents.TakeoverStarted, threadevents.TakeoverEnded:
+		thread, err := h.queries.GetChatThread(ctx, pgUUID(event.Thread))
+		if err != nil {
+			return err
+		}
+		return stream.writeJSON("takeover", takeoverPayload(thread.TakenOverAt))
+	}
+	return nil
+}
+
+func takeoverPayload(takenOverAt pgtype.Timestamptz) gin.H {
+	payload := gin.H{"active": takenOverAt.Valid}
+	if takenOverAt.Valid {
+		payload["since"] = takenOverAt.Time
+	}
+	return payload
+}
+
+// publishMessage tells the thread's subscribers about a stored message.
+func publishMessage(ctx context.Context, bus threadevents.Bus, threadUUID uuid.UUID, messageUUID pgtype.UUID) {
+	publishEvent(ctx, bus, threadevents.Event{
+		Thread:    threadUUID,
+		Type:      threadevents.Message,
+		MessageID: uuid.UUID(messageUUID.Bytes),
+	})
+}
+
+// publishEvent sends an event after its change was committed. Events only
+// speed up delivery, so failures are logged.
+func publishEvent(ctx context.Context, bus threadevents.Bus, event threadevents.Event) {
+	if err := bus.Publish(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("publish thread event error: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/web/middleware"
+)
+
+const maxFeedbackCommentLength = 1000
+
+// feedbackReasons are the reasons a visitor can pick for a rating.
+var feedbackReasons = map[string]bool{
+	"helpful":        true,
+	"funny":          true,
+	"inaccurate":     true,
+	"unhelpful":      true,
+	"off_topic":      true,
+	"wrong_emotion":  true,
+	"wrong_language": true,
+	"too_long":       true,
+	"inappropriate":  true,
+	"other":          true,
+}
+
+type feedbackRequest struct {
+	Rating  string `json:"rating"`
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+type feedbackResponse struct {
+	MessageID string    `json:"message_id"`
+	Rating    string    `json:"rating"`
+	Reason    string    `json:"reason,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HandleSubmitFeedback stores the visitor's rating of an assistant reply,
+// replacing the one they gave before.
+func (h *ChatHandler) HandleSubmitFeedback(c *gin.Context) {
+	msg, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+	if msg.Role != "assistant" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only assistant replies can be rated"})
+		return
+	}
+
+	var req feedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	rating := strings.ToLower(strings.TrimSpace(req.Rating))
+	if rating != "up" && rating != "down" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be up or down"})
+		return
+	}
+	reason := strings.ToLower(strings.TrimSpace(req.Reason))
+	if reason != "" && !feedbackReasons[reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown reason"})
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > maxFeedbackCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment is too long"})
+		return
+	}
+
+	feedback, err := h.queries.UpsertMessageFeedback(c.Request.Context(), db.UpsertMessageFeedbackParams{
+		MessageUuid: msg.Uuid,
+		VisitorUuid: pgUUID(middleware.VisitorID(c)),
+		Rating:      rating,
+		Reason:      pgText(reason),
+		Comment:     pgText(comment),
+	})
+	if err != nil {
+		log.Printf("store feedback error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store feedback"})
+		return
+	}
+	c.JSON(http.StatusOK, feedbackResponse{
+		MessageID: uuidString(feedback.MessageUuid),
+		Rating:    feedback.Rating,
+		Reason:    feedback.Reason.String,
+		Comment:   feedback.Comment.String,
+		CreatedAt: timeFromPg(feedback.CreatedAt),
+		UpdatedAt: timeFromPg(feedback.UpdatedAt),
+	})
+}
+
+// HandleDeleteFeedback withdraws the visitor's rating of a reply.
+func (h *ChatHandler) HandleDeleteFeedback(c *gin.Context) {
+	msg, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+	deleted, err := h.queries.DeleteMessageFeedback(c.Request.Context(), db.DeleteMessageFeedbackParams{
+		MessageUuid: msg.Uuid,
+		VisitorUuid: pgUUID(middleware.VisitorID(c)),
+	})
+	if err != nil {
+		log.Printf("delete feedback error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete feedback"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feedback not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
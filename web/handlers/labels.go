@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/threadlabel"
+)
+
+// maxLabelMessages bounds how much of a conversation is sent for labeling.
+const maxLabelMessages = 20
+
+// labelThread titles and tags the thread in the background after its first
+// reply. Later replies find the thread claimed and skip it; a failure
+// releases the claim, so the next reply tries again.
+func (h *ChatHandler) labelThread(threadUUID uuid.UUID, replyUUID pgtype.UUID) {
+	if h.labeler == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		claimed, err := h.queries.ClaimThreadLabels(ctx, pgUUID(threadUUID))
+		if err != nil {
+			log.Printf("claim thread labels error: %v", err)
+			return
+		}
+		if claimed == 0 {
+			return
+		}
+		history, err := h.loadPath(ctx, h.queries.Queries, replyUUID)
+		if err == nil {
+			_, err = applyLabels(ctx, h.queries.Queries, h.labeler, pgUUID(threadUUID), history, false)
+		}
+		if err != nil {
+			log.Printf("thread labels error: %v", err)
+			if err := h.queries.ReleaseThreadLabels(context.WithoutCancel(ctx), pgUUID(threadUUID)); err != nil {
+				log.Printf("release thread labels error: %v", err)
+			}
+		}
+	}()
+}
+
+// applyLabels labels the thread from messages and stores the result. The
+// title only replaces an existing one if replaceTitle is set, so titles
+// chosen by the visitor survive automatic labeling.
+func applyLabels(ctx context.Context, q *db.Queries, labeler threadlabel.Labeler, threadUUID pgtype.UUID, messages []db.ChatMessage, replaceTitle bool) (threadlabel.Labels, error) {
+	if len(messages) > maxLabelMessages {
+		messages = messages[:maxLabelMessages]
+	}
+	labels, err := labeler.Label(ctx, messages)
+	if err != nil {
+		return threadlabel.Labels{}, err
+	}
+	labels.Tags = nonNilTags(labels.Tags)
+	err = q.SetThreadLabels(ctx, db.SetThreadLabelsParams{
+		Uuid:         threadUUID,
+		Title:        pgText(labels.Title),
+		Tags:         labels.Tags,
+		ReplaceTitle: replaceTitle,
+	})
+	return labels, err
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWordDelay caps the typing time of a single word, e.g. a long URL.
+const maxWordDelay = time.Second
+
+// sseSink is where a streamed reply goes: text chunks as token events and
+// everything else as events in between, in the order they were sent.
+type sseSink interface {
+	Send(event string, payload any) error
+	Text(chunk string) error
+	// Close writes everything still queued and returns the first write
+	// error. Stop discards the queue instead.
+	Close() error
+	Stop()
+}
+
+func (h *ChatHandler) newSink(stream *sseStream) sseSink {
+	if h.cfg == nil || !h.cfg.AIPacingEnabled || h.cfg.AIPacingCharsPerSecond <= 0 {
+		return directSink{stream: stream}
+	}
+	return newPacedSink(stream, h.cfg.AIPacingCharsPerSecond, time.Duration(h.cfg.AIPacingPauseMs)*time.Millisecond, sleepContext)
+}
+
+// directSink writes everything as soon as it arrives.
+type directSink struct {
+	stream *sseStream
+}
+
+func (s directSink) Send(event string, payload any) error {
+	return s.stream.writeJSON(event, payload)
+}
+
+func (s directSink) Text(chunk string) error {
+	return s.stream.write("token", chunk)
+}
+
+func (s directSink) Close() error { return nil }
+
+func (s directSink) Stop() {}
+
+type sseItem struct {
+	event string
+	data  string
+	delay time.Duration
+}
+
+// pacedSink re-chunks text into words and writes them at a typing speed of
+// cps characters per second, pausing after punctuation. It sends a typing
+// event right away and before every segment after the first. Writing happens
+// on its own goroutine, so the reply can be stored while it is still being
+// typed out.
+type pacedSink struct {
+	stream *sseStream
+	ctx    context.Context
+	cps    float64
+	pause  time.Duration
+	// sleep waits for the delay of an item; tests replace the clock.
+	sleep func(context.Context, time.Duration) error
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []sseItem
+	closed  bool
+	stopped bool
+	err     error
+	done    chan struct{}
+
+	// Only used by the producer.
+	pending  strings.Builder
+	last     rune
+	segments int
+}
+
+func newPacedSink(stream *sseStream, cps float64, pause time.Duration, sleep func(context.Context, time.Duration) error) *pacedSink {
+	s := &pacedSink{
+		stream: stream,
+		ctx:    stream.c.Request.Context(),
+		cps:    cps,
+		pause:  pause,
+		sleep:  sleep,
+		done:   make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.enqueue(sseItem{event: "typing", data: "{}"})
+	go s.run()
+	return s
+}
+
+func (s *pacedSink) Send(event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	s.flushPending()
+	item := sseItem{event: event, data: string(data)}
+	if event == "segment_start" {
+		if s.segments > 0 {
+			index, _ := json.Marshal(gin.H{"index": s.segments})
+			s.enqueue(sseItem{event: "typing", data: string(index)})
+			item.delay = 2 * s.pause
+		}
+		s.segments++
+	}
+	s.enqueue(item)
+	return s.failed()
+}
+
+func (s *pacedSink) Text(chunk string) error {
+	s.pending.WriteString(chunk)
+	words := splitWords(s.pending.String())
+	last := words[len(words)-1]
+	if r, _ := utf8.DecodeLastRuneInString(last); !unicode.IsSpace(r) {
+		// The last word may continue in the next chunk.
+		words = words[:len(words)-1]
+	} else {
+		last = ""
+	}
+	s.pending.Reset()
+	s.pending.WriteString(last)
+	for _, word := range words {
+		s.enqueueWord(word)
+	}
+	return s.failed()
+}
+
+func (s *pacedSink) Close() error {
+	s.flushPending()
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	<-s.done
+	return s.failed()
+}
+
+func (s *pacedSink) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *pacedSink) flushPending() {
+	if s.pending.Len() == 0 {
+		return
+	}
+	s.enqueueWord(s.pending.String())
+	s.pending.Reset()
+}
+
+func (s *pacedSink) enqueueWord(word string) {
+	trimmed := strings.TrimSpace(word)
+	delay := time.Duration(float64(utf8.RuneCountInString(trimmed)) / s.cps * float64(time.Second))
+	if delay > maxWordDelay {
+		delay = maxWordDelay
+	}
+	switch s.last {
+	case '.', '!', '?', '…', '\n':
+		delay += s.pause
+	case ',', ';', ':':
+		delay += s.pause / 2
+	}
+	if strings.ContainsRune(word, '\n') {
+		s.last = '\n'
+	} else if r, _ := utf8.DecodeLastRuneInString(trimmed); r != utf8.RuneError {
+		s.last = r
+	}
+	s.enqueue(sseItem{event: "token", data: word, delay: delay})
+}
+
+func (s *pacedSink) enqueue(item sseItem) {
+	s.mu.Lock()
+	s.queue = append(s.queue, item)
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+func (s *pacedSink) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *pacedSink) run() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped || len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		item := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		if item.delay > 0 {
+			if err := s.sleep(s.ctx, item.delay); err != nil {
+				s.fail(err)
+				return
+			}
+		}
+		if err := s.stream.write(item.event, item.data); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+func (s *pacedSink) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.stopped = true
+	s.queue = nil
+	s.mu.Unlock()
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// splitWords cuts text after every run of whitespace, so each piece is a word
+// with the whitespace that follows it.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	prevSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if i > start && !space && prevSpace {
+			words = append(words, text[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	return append(words, text[start:])
+}
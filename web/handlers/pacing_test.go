@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: []string{""}},
+		{text: "Hello", want: []string{"Hello"}},
+		{text: "Hello world", want: []string{"Hello ", "world"}},
+		{text: "Hello  world ", want: []string{"Hello  ", "world "}},
+		{text: " leading", want: []string{" ", "leading"}},
+		{text: "one,\ntwo\tthree", want: []string{"one,\n", "two\t", "three"}},
+		{text: "çay ve kahve", want: []string{"çay ", "ve ", "kahve"}},
+	}
+	for _, tt := range tests {
+		if got := splitWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// fakeClock records the delays a pacedSink waits for without sleeping.
+type fakeClock struct {
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.delays = append(c.delays, d)
+	c.mu.Unlock()
+	return ctx.Err()
+}
+
+func newTestPacedSink(t *testing.T, ctx context.Context, sleep func(context.Context, time.Duration) error) (*pacedSink, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/chat/stream", nil).WithContext(ctx)
+	// 10 characters per second: a word of n characters takes n*100ms.
+	return newPacedSink(newSSEStream(c), 10, time.Second, sleep), rec
+}
+
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		var event sseEvent
+		var data []string
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event.event = name
+			} else if value, ok := strings.CutPrefix(line, "data: "); ok {
+				data = append(data, value)
+			}
+		}
+		event.data = strings.Join(data, "\n")
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestPacedSink(t *testing.T) {
+	clock := &fakeClock{}
+	sink, rec := newTestPacedSink(t, context.Background(), clock.sleep)
+
+	steps := []func() error{
+		func() error { return sink.Send("segment_start", gin.H{"index": 0}) },
+		func() error { return sink.Text("Hi the") },
+		func() error { return sink.Text("re. How") },
+		func() error { return sink.Text(" are you,") },
+		func() error { return sink.Text(" friend") },
+		func() error { return sink.Send("segment_start", gin.H{"index": 1}) },
+		func() error { return sink.Text("Bye") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("sink: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []sseEvent{
+		{"typing", "{}"},
+		{"segment_start", `{"index":0}`},
+		{"token", "Hi "},
+		{"token", "there. "},
+		{"token", "How "},
+		{"token", "are "},
+		{"token", "you, "},
+		{"token", "friend"},
+		{"typing", `{"index":1}`},
+		{"segment_start", `{"index":1}`},
+		// The last word is only written by Close.
+		{"token", "Bye"},
+	}
+	if got := parseSSE(rec.Body.String()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q,\nwant %q", got, want)
+	}
+
+	ms := time.Millisecond
+	wantDelays := []time.Duration{
+		200 * ms,               // Hi
+		600 * ms,               // there.
+		300*ms + time.Second,   // How, after a sentence
+		300 * ms,               // are
+		400 * ms,               // you,
+		600*ms + time.Second/2, // friend, after a comma
+		2 * time.Second,        // the second segment
+		300 * ms,               // Bye
+	}
+	if !reflect.DeepEqual(clock.delays, wantDelays) {
+		t.Fatalf("delays = %v, want %v", clock.delays, wantDelays)
+	}
+}
+
+func TestPacedSinkCapsLongWords(t *testing.T) {
+	clock := &fakeClock{}
+	sink, _ := newTestPacedSink(t, context.Background(), clock.sleep)
+	_ = sink.Text(strings.Repeat("x", 100))
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if want := []time.Duration{maxWordDelay}; !reflect.DeepEqual(clock.delays, want) {
+		t.Fatalf("delays = %v, want %v", clock.delays, want)
+	}
+}
+
+func TestPacedSinkStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	block := make(chan struct{})
+	var once sync.Once
+	started := make(chan struct{})
+	sink, rec := newTestPacedSink(t, ctx, func(ctx context.Context, d time.Duration) error {
+		once.Do(func() { close(started) })
+		select {
+		case <-block:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	_ = sink.Text("one two three ")
+	<-started
+	// Stop discards the queue; the word being typed is cut short by the
+	// cancelled request.
+	cancel()
+	sink.Stop()
+	if got := parseSSE(rec.Body.String()); !reflect.DeepEqual(got, []sseEvent{{"typing", "{}"}}) {
+		t.Fatalf("events = %q, want only typing", got)
+	}
+	if err := sink.Text("four "); err == nil {
+		t.Fatal("Text after the request was cancelled succeeded")
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models/db"
+)
+
+type alternativeResponse struct {
+	messageResponse
+	Active bool `json:"active"`
+}
+
+type alternativesResponse struct {
+	ParentID     string                `json:"parent_id,omitempty"`
+	ActiveID     string                `json:"active_id,omitempty"`
+	Alternatives []alternativeResponse `json:"alternatives"`
+}
+
+func (h *ChatHandler) HandleRegenerateReply(c *gin.Context) {
+	original, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+
+	// A failed user message is retried by answering it again.
+	userMsg := original
+	if original.Role != "user" || original.Status != "failed" {
+		if original.Role != "assistant" || !original.ParentUuid.Valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only assistant replies and failed messages can be regenerated"})
+			return
+		}
+		var err error
+		userMsg, err = h.queries.GetChatMessage(c.Request.Context(), original.ParentUuid)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+	}
+	// The takeover is checked under the lock, so one that starts while this
+	// request waits for it is not answered by the AI.
+	unlock, ok := h.lockThread(c, uuid.UUID(original.ThreadUuid.Bytes))
+	if !ok {
+		return
+	}
+	defer unlock()
+	visitorUUID, ok := h.threadVisitor(c, original.ThreadUuid)
+	if !ok {
+		return
+	}
+
+	h.replyTo(c, uuid.UUID(original.ThreadUuid.Bytes), visitorUUID, userMsg)
+}
+
+// replyTo generates a new assistant reply to userMsg from the branch that
+// leads to it and responds like HandleSendMessage, streaming if requested.
+func (h *ChatHandler) replyTo(c *gin.Context, threadUUID uuid.UUID, visitorUUID uuid.UUID, userMsg db.ChatMessage) {
+	ctx := c.Request.Context()
+	history, err := h.loadPath(ctx, h.queries.Queries, userMsg.Uuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load history"})
+		return
+	}
+
+	attachments, err := h.loadAttachments(ctx, []db.ChatMessage{userMsg})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load attachments"})
+		return
+	}
+	opts := h.replyOptions(c, visitorUUID, userMsg, history)
+
+	if strings.EqualFold(c.Query("stream"), "true") {
+		h.streamChat(c, threadUUID, visitorUUID, userMsg, attachments[userMsg.Uuid], history, opts)
+		return
+	}
+
+	aiReply, err := h.ai.GenerateReply(ctx, history, opts)
+	if err != nil {
+		h.markFailed(ctx, userMsg.Uuid)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "ai request failed"})
+		log.Printf("ai error: %v", err)
+		return
+	}
+
+	assistantMsg, err := h.storeReply(ctx, threadUUID, userMsg.Uuid, aiReply)
+	if err != nil {
+		h.markFailed(ctx, userMsg.Uuid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store assistant message"})
+		return
+	}
+
+	userMsg.Status = "sent"
+
+	assistant := toMessageResponse(assistantMsg, nil)
+	resp := sendMessageResponse{
+		VisitorID:        uuidOrEmpty(visitorUUID),
+		ThreadID:         threadUUID.String(),
+		UserMessage:      toMessageResponse(userMsg, attachments[userMsg.Uuid]),
+		AssistantMessage: &assistant,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *ChatHandler) HandleGetAlternatives(c *gin.Context) {
+	msg, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.alternatives(c.Request.Context(), msg.ThreadUuid, msg.ParentUuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load alternatives"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *ChatHandler) HandleActivateMessage(c *gin.Context) {
+	msg, ok := h.loadMessageParam(c)
+	if !ok {
+		return
+	}
+
+	unlock, ok := h.lockThread(c, uuid.UUID(msg.ThreadUuid.Bytes))
+	if !ok {
+		return
+	}
+	defer unlock()
+	if _, ok := h.threadVisitor(c, msg.ThreadUuid); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.queries.ActivateMessagePath(ctx, db.ActivateMessagePathParams{
+		ActiveUuid: msg.Uuid,
+		ThreadUuid: msg.ThreadUuid,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to activate message"})
+		return
+	}
+
+	resp, err := h.alternatives(ctx, msg.ThreadUuid, msg.ParentUuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load alternatives"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *ChatHandler) loadMessageParam(c *gin.Context) (db.ChatMessage, bool) {
+	messageUUID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message_id"})
+		return db.ChatMessage{}, false
+	}
+	ctx := c.Request.Context()
+	msg, err := h.queries.GetChatMessage(ctx, pgUUID(messageUUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return db.ChatMessage{}, false
+	}
+	thread, err := h.queries.GetChatThread(ctx, msg.ThreadUuid)
+	if err != nil || !ownsThread(c, thread) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return db.ChatMessage{}, false
+	}
+	return msg, true
+}
+
+// threadVisitor loads a thread of the request's visitor that the AI may
+// answer in, touches the visitor and returns its id. Threads a human has
+// taken over respond with 409.
+func (h *ChatHandler) threadVisitor(c *gin.Context, threadUUID pgtype.UUID) (uuid.UUID, bool) {
+	ctx := c.Request.Context()
+	thread, err := h.queries.GetChatThread(ctx, threadUUID)
+	if err != nil || !ownsThread(c, thread) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return uuid.UUID{}, false
+	}
+	if thread.TakenOverAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "thread is taken over"})
+		return uuid.UUID{}, false
+	}
+	h.touchVisitor(ctx, thread.VisitorUuid, c)
+	return uuid.UUID(thread.VisitorUuid.Bytes), true
+}
+
+// alternatives lists the versions of a message, i.e. all children of its
+// parent. Root messages of a thread have an invalid parent.
+func (h *ChatHandler) alternatives(ctx context.Context, threadUUID, parentUUID pgtype.UUID) (alternativesResponse, error) {
+	siblings, err := h.queries.GetMessageSiblings(ctx, db.GetMessageSiblingsParams{
+		ThreadUuid: threadUUID,
+		ParentUuid: parentUUID,
+	})
+	if err != nil {
+		return alternativesResponse{}, err
+	}
+	attachments, err := h.loadAttachments(ctx, siblings)
+	if err != nil {
+		return alternativesResponse{}, err
+	}
+
+	resp := alternativesResponse{
+		ParentID:     uuidString(parentUUID),
+		Alternatives: make([]alternativeResponse, 0, len(siblings)),
+	}
+	for _, sibling := range siblings {
+		if sibling.IsActive {
+			resp.ActiveID = uuidString(sibling.Uuid)
+		}
+		resp.Alternatives = append(resp.Alternatives, alternativeResponse{
+			messageResponse: toMessageResponse(sibling, attachments[sibling.Uuid]),
+			Active:          sibling.IsActive,
+		})
+	}
+	return resp, nil
+}
+
+// countAlternatives returns how many children each parent has in a thread,
+// keyed by parent id. Root messages are counted under the zero UUID.
+func (h *ChatHandler) countAlternatives(ctx context.Context, threadUUID pgtype.UUID) (map[pgtype.UUID]int, error) {
+	rows, err := h.queries.CountSiblings(ctx, threadUUID)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[pgtype.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.ParentUuid] = int(row.Siblings)
+	}
+	return counts, nil
+}
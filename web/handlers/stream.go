@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talk-to-ugur-back/ai"
+)
+
+var (
+	errFirstTokenTimeout = errors.New("no reply from the model within the first token timeout")
+	errStreamTimeout     = errors.New("reply exceeded the maximum stream duration")
+)
+
+// streamError is the payload of the SSE error event.
+type streamError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+// sseStream serializes writes to an SSE response, so heartbeats can be sent
+// from another goroutine.
+type sseStream struct {
+	c         *gin.Context
+	mu        sync.Mutex
+	lastWrite time.Time
+}
+
+func newSSEStream(c *gin.Context) *sseStream {
+	return &sseStream{c: c, lastWrite: time.Now()}
+}
+
+func (s *sseStream) write(event, data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastWrite = time.Now()
+	return writeSSEData(s.c, event, data)
+}
+
+func (s *sseStream) writeJSON(event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.write(event, string(data))
+}
+
+// writeError sends the error event. Retryable errors are also recorded on the
+// context, so that the response is not kept for idempotent replays.
+func (s *sseStream) writeError(e streamError) {
+	if e.Retryable {
+		_ = s.c.Error(errors.New(e.Code + ": " + e.Message))
+	}
+	_ = s.writeJSON("error", e)
+}
+
+// heartbeat writes an SSE comment whenever nothing was written for interval,
+// so proxies keep the connection open while the model is slow. It returns a
+// function that stops it.
+func (s *sseStream) heartbeat(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			case <-s.c.Request.Context().Done():
+				return
+			}
+			s.mu.Lock()
+			if time.Since(s.lastWrite) >= interval {
+				s.lastWrite = time.Now()
+				if _, err := s.c.Writer.Write([]byte(": keepalive\n\n")); err == nil {
+					if flusher, ok := s.c.Writer.(http.Flusher); ok {
+						flusher.Flush()
+					}
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// streamContext bounds a streamed reply by the maximum stream duration and the
+// first token timeout. Call the returned firstToken func when the model starts
+// answering; cancel releases the context.
+func (h *ChatHandler) streamContext(parent context.Context) (ctx context.Context, firstToken func(), cancel func()) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	cancels := []func(){func() { cancelCause(nil) }}
+	if h.cfg != nil && h.cfg.AIStreamMaxSeconds > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, time.Duration(h.cfg.AIStreamMaxSeconds)*time.Second, errStreamTimeout)
+		cancels = append(cancels, cancelTimeout)
+	}
+
+	firstToken = func() {}
+	if h.cfg != nil && h.cfg.AIStreamFirstTokenTimeoutSeconds > 0 {
+		timer := time.AfterFunc(time.Duration(h.cfg.AIStreamFirstTokenTimeoutSeconds)*time.Second, func() {
+			cancelCause(errFirstTokenTimeout)
+		})
+		var once sync.Once
+		firstToken = func() { once.Do(func() { timer.Stop() }) }
+		cancels = append(cancels, func() { timer.Stop() })
+	}
+
+	return ctx, firstToken, func() {
+		for i := len(cancels) - 1; i >= 0; i-- {
+			cancels[i]()
+		}
+	}
+}
+
+// classifyStreamError turns a failed reply into the error event payload. ctx
+// is the stream context, whose cause tells timeouts apart.
+func classifyStreamError(ctx context.Context, err error) streamError {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errFirstTokenTimeout):
+		return streamError{Code: "first_token_timeout", Message: "the model did not start answering in time", Retryable: true}
+	case errors.Is(cause, errStreamTimeout):
+		return streamError{Code: "stream_timeout", Message: "the reply took too long", Retryable: true}
+	}
+
+	switch {
+	case errors.Is(err, ai.ErrRefused):
+		return streamError{Code: "refused", Message: "the model refused to answer", Retryable: false}
+	case errors.Is(err, ai.ErrEmptyReply):
+		return streamError{Code: "empty_reply", Message: "the model returned an empty reply", Retryable: true}
+	}
+
+	switch status := ai.StatusCode(err); {
+	case status == http.StatusTooManyRequests:
+		return streamError{Code: "rate_limited", Message: "the model is busy, try again shortly", Retryable: true}
+	case status >= 400 && status < 500:
+		return streamError{Code: "upstream_error", Message: "ai request failed", Retryable: false}
+	}
+	return streamError{Code: "upstream_unavailable", Message: "ai request failed", Retryable: true}
+}
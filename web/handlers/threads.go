@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models"
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/storage"
+	"talk-to-ugur-back/web/middleware"
+)
+
+const (
+	defaultThreadPageSize = 20
+	maxThreadPageSize     = 100
+	maxThreadTitleLength  = 200
+	threadPreviewLength   = 140
+)
+
+type threadResponse struct {
+	ID             string                `json:"id"`
+	Title          *string               `json:"title"`
+	Tags           []string              `json:"tags"`
+	MessageCount   int64                 `json:"message_count"`
+	LastMessage    *threadPreviewMessage `json:"last_message"`
+	Archived       bool                  `json:"archived"`
+	ArchivedAt     *time.Time            `json:"archived_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	LastActivityAt time.Time             `json:"last_activity_at"`
+}
+
+type threadPreviewMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type updateThreadRequest struct {
+	Title    *string `json:"title"`
+	Archived *bool   `json:"archived"`
+}
+
+// HandleListThreads lists the visitor's threads, most recently active first.
+// Archived threads are listed separately with ?archived=true.
+func (h *ChatHandler) HandleListThreads(c *gin.Context) {
+	archived, err := strconv.ParseBool(c.DefaultQuery("archived", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archived must be true or false"})
+		return
+	}
+	pageSize, err := parsePageSize(c, defaultThreadPageSize, maxThreadPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	params := db.ListVisitorThreadsParams{
+		VisitorUuid: pgUUID(middleware.VisitorID(c)),
+		Archived:    archived,
+		// One extra row tells whether there is a next page.
+		PageSize: int32(pageSize + 1),
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		params.CursorActivity, params.CursorUuid, err = decodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	rows, err := h.queries.ListVisitorThreads(c.Request.Context(), params)
+	if err != nil {
+		log.Printf("list threads error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load threads"})
+		return
+	}
+
+	var nextCursor string
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		nextCursor = encodeCursor(last.LastActivityAt, last.Uuid)
+	}
+	threads := make([]threadResponse, 0, len(rows))
+	for _, row := range rows {
+		threads = append(threads, toThreadResponse(db.GetThreadSummaryRow(row)))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"threads":     threads,
+		"next_cursor": nextCursor,
+	})
+}
+
+// HandleUpdateThread renames, archives or unarchives a thread. An empty title
+// clears it.
+func (h *ChatHandler) HandleUpdateThread(c *gin.Context) {
+	threadUUID, ok := h.loadOwnedThread(c)
+	if !ok {
+		return
+	}
+
+	var req updateThreadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Title == nil && req.Archived == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title or archived is required"})
+		return
+	}
+	var title string
+	if req.Title != nil {
+		title = strings.TrimSpace(*req.Title)
+		if utf8.RuneCountInString(title) > maxThreadTitleLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title is too long"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	var summary db.GetThreadSummaryRow
+	err := h.queries.InTx(ctx, func(q *db.Queries) error {
+		if req.Title != nil {
+			if err := q.SetChatThreadTitle(ctx, db.SetChatThreadTitleParams{
+				Uuid:  threadUUID,
+				Title: pgText(title),
+			}); err != nil {
+				return err
+			}
+		}
+		if req.Archived != nil {
+			if err := q.SetChatThreadArchived(ctx, db.SetChatThreadArchivedParams{
+				Uuid:     threadUUID,
+				Archived: *req.Archived,
+			}); err != nil {
+				return err
+			}
+		}
+		var err error
+		summary, err = q.GetThreadSummary(ctx, threadUUID)
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "failed to update thread")
+		return
+	}
+	c.JSON(http.StatusOK, toThreadResponse(summary))
+}
+
+// HandleDeleteThread deletes a thread with its messages, attachments and
+// audio.
+func (h *ChatHandler) HandleDeleteThread(c *gin.Context) {
+	threadUUID, ok := h.loadOwnedThread(c)
+	if !ok {
+		return
+	}
+	unlock, ok := h.lockThread(c, uuid.UUID(threadUUID.Bytes))
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	found, err := deleteThread(c.Request.Context(), h.queries, h.store, threadUUID)
+	if err != nil {
+		log.Printf("delete thread error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete thread"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// deleteThread deletes a thread with its messages and then the files of its
+// attachments and audio. It reports false if the thread did not exist.
+func deleteThread(ctx context.Context, queries *models.Store, files storage.Store, threadUUID pgtype.UUID) (bool, error) {
+	var keys []string
+	var deleted int64
+	err := queries.InTx(ctx, func(q *db.Queries) error {
+		var err error
+		if keys, err = q.ListThreadStorageKeys(ctx, threadUUID); err != nil {
+			return err
+		}
+		deleted, err = q.DeleteChatThread(ctx, threadUUID)
+		return err
+	})
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+
+	// The rows are gone, so leftover files are unreachable; failures only
+	// cost storage.
+	deleteCtx := context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := files.Delete(deleteCtx, key); err != nil {
+			log.Printf("delete stored file %s error: %v", key, err)
+		}
+	}
+	return true, nil
+}
+
+// loadOwnedThread parses the thread_id param and responds with 404 unless the
+// thread belongs to the visitor of the request.
+func (h *ChatHandler) loadOwnedThread(c *gin.Context) (pgtype.UUID, bool) {
+	threadUUID, err := uuid.Parse(c.Param("thread_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread_id"})
+		return pgtype.UUID{}, false
+	}
+	thread, err := h.queries.GetChatThread(c.Request.Context(), pgUUID(threadUUID))
+	if err != nil || !ownsThread(c, thread) {
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("load thread error: %v", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return pgtype.UUID{}, false
+	}
+	return thread.Uuid, true
+}
+
+func toThreadResponse(row db.GetThreadSummaryRow) threadResponse {
+	resp := threadResponse{
+		ID:             uuidString(row.Uuid),
+		Tags:           nonNilTags(row.Tags),
+		MessageCount:   row.MessageCount,
+		Archived:       row.ArchivedAt.Valid,
+		CreatedAt:      timeFromPg(row.CreatedAt),
+		LastActivityAt: timeFromPg(row.LastActivityAt),
+	}
+	if row.Title.Valid {
+		title := row.Title.String
+		resp.Title = &title
+	}
+	if row.ArchivedAt.Valid {
+		archivedAt := row.ArchivedAt.Time
+		resp.ArchivedAt = &archivedAt
+	}
+	if row.LastMessageRole.Valid {
+		resp.LastMessage = &threadPreviewMessage{
+			Role:    row.LastMessageRole.String,
+			Content: previewText(row.LastMessageContent.String),
+		}
+	}
+	return resp
+}
+
+// previewText shortens content to threadPreviewLength runes on one line.
+func previewText(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) <= threadPreviewLength {
+		return content
+	}
+	runes := []rune(content)
+	return strings.TrimSpace(string(runes[:threadPreviewLength])) + "…"
+}
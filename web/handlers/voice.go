@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/speech"
+	"talk-to-ugur-back/storage"
+)
+
+var audioExtensions = map[string]string{
+	"audio/mpeg": ".mp3",
+	"audio/wav":  ".wav",
+	"audio/webm": ".webm",
+	"audio/ogg":  ".ogg",
+	"audio/mp4":  ".m4a",
+	"audio/flac": ".flac",
+}
+
+type audioResponse struct {
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	URL         string `json:"url"`
+}
+
+type voiceMessageResponse struct {
+	sendMessageResponse
+	Transcript string `json:"transcript"`
+}
+
+func (h *ChatHandler) HandleSendVoiceMessage(c *gin.Context) {
+	audio, filename, err := h.readVoiceUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req sendMessageRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	// Transcription is paid for, so the thread is checked and locked first.
+	if !h.ownsRequestThread(c, req) {
+		return
+	}
+	unlock, ok := h.lockRequestThread(c, req)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	ctx := c.Request.Context()
+	transcription, err := h.stt.Transcribe(ctx, audio, filename)
+	if err != nil {
+		log.Printf("stt error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "transcription failed"})
+		return
+	}
+	message := strings.TrimSpace(transcription.Text)
+	if message == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no speech detected"})
+		return
+	}
+
+	turn, ok := h.prepareChat(c, req, message, nil, &audio)
+	if !ok {
+		return
+	}
+	userAudio := turn.audio
+	if turn.takenOver {
+		resp := voiceMessageResponse{
+			sendMessageResponse: sendMessageResponse{
+				VisitorID:   uuidOrEmpty(turn.visitorUUID),
+				ThreadID:    turn.threadUUID.String(),
+				UserMessage: toMessageResponse(turn.userMsg, nil),
+				TakenOver:   true,
+			},
+			Transcript: message,
+		}
+		resp.UserMessage.Audio = toAudioResponse(userAudio)
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	aiReply, err := h.ai.GenerateReply(ctx, turn.history, h.replyOptions(c, turn.visitorUUID, turn.userMsg, turn.history))
+	if err != nil {
+		h.markFailed(ctx, turn.userMsg.Uuid)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "ai request failed"})
+		log.Printf("ai error: %v", err)
+		return
+	}
+
+	assistantMsg, err := h.storeReply(ctx, turn.threadUUID, turn.userMsg.Uuid, aiReply)
+	if err != nil {
+		h.markFailed(ctx, turn.userMsg.Uuid)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store assistant message"})
+		return
+	}
+
+	var replyAudio *db.ChatMessageAudio
+	synthesized, err := h.tts.Synthesize(ctx, aiReply.Text, aiReply.Emotion)
+	if err != nil {
+		log.Printf("tts error: %v", err)
+	} else if replyAudio, err = h.saveAudio(ctx, h.queries.Queries, assistantMsg.Uuid, synthesized); err != nil {
+		log.Printf("audio store error: %v", err)
+	}
+
+	assistant := toMessageResponse(assistantMsg, nil)
+	resp := voiceMessageResponse{
+		sendMessageResponse: sendMessageResponse{
+			VisitorID:        uuidOrEmpty(turn.visitorUUID),
+			ThreadID:         turn.threadUUID.String(),
+			UserMessage:      toMessageResponse(turn.userMsg, nil),
+			AssistantMessage: &assistant,
+		},
+		Transcript: message,
+	}
+	resp.UserMessage.Audio = toAudioResponse(userAudio)
+	resp.AssistantMessage.Audio = toAudioResponse(replyAudio)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *ChatHandler) HandleGetAudio(c *gin.Context) {
+	audioUUID, err := uuid.Parse(c.Param("audio_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid audio_id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	audio, err := h.queries.GetChatMessageAudio(ctx, pgUUID(audioUUID))
+	if err != nil || !h.ownsMessage(c, audio.MessageUuid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "audio not found"})
+		return
+	}
+
+	data, err := h.store.Get(ctx, audio.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "audio not found"})
+			return
+		}
+		log.Printf("audio read error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load audio"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Data(http.StatusOK, audio.ContentType, data)
+}
+
+func (h *ChatHandler) maxAudioBytes() int64 {
+	if h.cfg == nil || h.cfg.SpeechMaxAudioBytes <= 0 {
+		return 10 << 20
+	}
+	return h.cfg.SpeechMaxAudioBytes
+}
+
+func (h *ChatHandler) readVoiceUpload(c *gin.Context) (speech.Audio, string, error) {
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return speech.Audio{}, "", errors.New("expected multipart/form-data")
+	}
+	maxBytes := h.maxAudioBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+
+	file, err := c.FormFile("audio")
+	if err != nil {
+		return speech.Audio{}, "", errors.New("audio is required")
+	}
+	if file.Size > maxBytes {
+		return speech.Audio{}, "", fmt.Errorf("audio is too large (max %d bytes)", maxBytes)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return speech.Audio{}, "", errors.New("invalid audio")
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return speech.Audio{}, "", errors.New("invalid audio")
+	}
+	if int64(len(data)) > maxBytes {
+		return speech.Audio{}, "", fmt.Errorf("audio is too large (max %d bytes)", maxBytes)
+	}
+
+	contentType := normalizeAudioType(file.Header.Get("Content-Type"))
+	if contentType == "" {
+		contentType = normalizeAudioType(http.DetectContentType(data))
+	}
+	if contentType == "" {
+		return speech.Audio{}, "", errors.New("unsupported audio format")
+	}
+
+	return speech.Audio{ContentType: contentType, Data: data}, filepath.Base(strings.TrimSpace(file.Filename)), nil
+}
+
+// normalizeAudioType strips codec parameters and maps the video/webm type
+// browsers report for MediaRecorder output to audio/webm.
+func normalizeAudioType(raw string) string {
+	mediaType, _, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "video/webm":
+		return "audio/webm"
+	case "audio/mp3":
+		return "audio/mpeg"
+	case "audio/wave", "audio/x-wav":
+		return "audio/wav"
+	}
+	if strings.HasPrefix(mediaType, "audio/") {
+		return mediaType
+	}
+	return ""
+}
+
+// ownsRequestThread responds with 400 or 404 unless the message goes to a new
+// thread or one of the visitor's threads.
+func (h *ChatHandler) ownsRequestThread(c *gin.Context, req sendMessageRequest) bool {
+	if req.ThreadID == "" {
+		return true
+	}
+	threadUUID, err := uuid.Parse(req.ThreadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread_id"})
+		return false
+	}
+	thread, err := h.queries.GetChatThread(c.Request.Context(), pgUUID(threadUUID))
+	if err != nil || !ownsThread(c, thread) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thread not found"})
+		return false
+	}
+	return true
+}
+
+// saveAudio stores audio for a message through q. When the row cannot be
+// written the stored object is removed again.
+func (h *ChatHandler) saveAudio(ctx context.Context, q *db.Queries, messageUUID pgtype.UUID, audio speech.Audio) (*db.ChatMessageAudio, error) {
+	audioUUID := uuid.New()
+	key := "audio/" + audioUUID.String() + audioExtensions[audio.ContentType]
+	if err := h.store.Put(ctx, key, audio.ContentType, audio.Data); err != nil {
+		return nil, err
+	}
+	saved, err := q.CreateChatMessageAudio(ctx, db.CreateChatMessageAudioParams{
+		Uuid:        pgUUID(audioUUID),
+		MessageUuid: messageUUID,
+		StorageKey:  key,
+		ContentType: audio.ContentType,
+		SizeBytes:   int64(len(audio.Data)),
+	})
+	if err != nil {
+		h.deleteAudio(ctx, &db.ChatMessageAudio{StorageKey: key})
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// deleteAudio removes the stored object of audio whose row was not committed.
+func (h *ChatHandler) deleteAudio(ctx context.Context, audio *db.ChatMessageAudio) {
+	if audio == nil {
+		return
+	}
+	if err := h.store.Delete(context.WithoutCancel(ctx), audio.StorageKey); err != nil {
+		log.Printf("audio delete error: %v", err)
+	}
+}
+
+func (h *ChatHandler) loadAudio(ctx context.Context, messages []db.ChatMessage) (map[pgtype.UUID]db.ChatMessageAudio, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	ids := make([]pgtype.UUID, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.Uuid)
+	}
+
+	items, err := h.queries.GetChatMessageAudioByMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byMessage := make(map[pgtype.UUID]db.ChatMessageAudio, len(items))
+	for _, item := range items {
+		byMessage[item.MessageUuid] = item
+	}
+	return byMessage, nil
+}
+
+func toAudioResponse(audio *db.ChatMessageAudio) *audioResponse {
+	if audio == nil {
+		return nil
+	}
+	id := uuidString(audio.Uuid)
+	return &audioResponse{
+		ID:          id,
+		ContentType: audio.ContentType,
+		SizeBytes:   audio.SizeBytes,
+		URL:         "/api/v1/chat/audio/" + id,
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sethvargo/go-envconfig"
+
+	"talk-to-ugur-back/ai"
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/models"
+	"talk-to-ugur-back/speech"
+	"talk-to-ugur-back/storage"
+	"talk-to-ugur-back/threadevents"
+	"talk-to-ugur-back/threadlock"
+	"talk-to-ugur-back/visitortoken"
+	"talk-to-ugur-back/web/middleware"
+)
+
+const fakeReply = "Hi, I'm Ugur. Nice to hear your voice!"
+
+// newVoiceTestRouter wires a ChatHandler to the database at TEST_DATABASE_URL,
+// the fake speech providers, local storage and a fake chat completions API.
+// Tests using it are skipped without a database.
+func newVoiceTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := json.Marshal(map[string]string{"emotion": "happy", "reply": fakeReply})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": string(content)}}},
+		})
+	}))
+	t.Cleanup(openAI.Close)
+
+	cfg := &config.Config{}
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target: cfg,
+		Lookuper: envconfig.MapLookuper(map[string]string{
+			"POSTGRES_CONN_STR":      dsn,
+			"OPENAI_API_KEY":         "test-key",
+			"OPENAI_BASE_URL":        openAI.URL + "/v1",
+			"SPEECH_STT_PROVIDER":    "fake",
+			"SPEECH_TTS_PROVIDER":    "fake",
+			"THREAD_LABELS_PROVIDER": "off",
+			"VISITOR_COOKIE_SECURE":  "false",
+			"VISITOR_TOKEN_KEYS":     "test:0123456789abcdef0123456789abcdef",
+			"VISITOR_TOKEN_KEY_ID":   "test",
+			"STORAGE_LOCAL_DIR":      t.TempDir(),
+		}),
+	}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.AISystemPromptPath = ""
+	cfg.AISystemPrompt = "You are Ugur."
+
+	if err := models.Migrate(dsn); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	store := models.NewStore(pool)
+
+	aiClient, err := ai.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("ai client: %v", err)
+	}
+	if err := LoadEmotions(ctx, store.Queries, aiClient.Emotions()); err != nil {
+		t.Fatalf("load emotions: %v", err)
+	}
+	stt, err := speech.NewTranscriber(cfg)
+	if err != nil {
+		t.Fatalf("transcriber: %v", err)
+	}
+	tts, err := speech.NewSynthesizer(cfg)
+	if err != nil {
+		t.Fatalf("synthesizer: %v", err)
+	}
+	signer, err := visitortoken.NewSigner(cfg)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	auth, err := middleware.NewVisitorAuth(cfg, signer)
+	if err != nil {
+		t.Fatalf("visitor auth: %v", err)
+	}
+
+	h := NewChatHandler(store, aiClient, storage.NewLocalStore(cfg.StorageLocalDir), stt, tts,
+		threadlock.NewMemoryLocker(0), nil, threadevents.NewMemoryBus(), auth, cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/visitors", h.HandleCreateVisitor)
+	chat := router.Group("/chat")
+	chat.Use(middleware.VisitorAuthMiddleware(auth))
+	chat.POST("/voice", h.HandleSendVoiceMessage)
+	chat.GET("/audio/:audio_id", h.HandleGetAudio)
+	return router
+}
+
+func TestVoiceMessage(t *testing.T) {
+	router := newVoiceTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/visitors", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create visitor: %d %s", rec.Code, rec.Body)
+	}
+	var visitor createVisitorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &visitor); err != nil {
+		t.Fatalf("decode visitor: %v", err)
+	}
+
+	// The fake transcriber uses plain-text "audio" as the transcript.
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="audio"; filename="hello.webm"`)
+	header.Set("Content-Type", "audio/webm")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	_, _ = part.Write([]byte("Hello Ugur, can you hear me?"))
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/voice", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Visitor-Token", visitor.VisitorToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("send voice message: %d %s", rec.Code, rec.Body)
+	}
+
+	var resp voiceMessageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Transcript != "Hello Ugur, can you hear me?" || resp.UserMessage.Content != resp.Transcript {
+		t.Fatalf("transcript %q, user message %q", resp.Transcript, resp.UserMessage.Content)
+	}
+	if resp.UserMessage.Audio == nil || resp.UserMessage.Audio.ContentType != "audio/webm" {
+		t.Fatalf("user audio = %+v", resp.UserMessage.Audio)
+	}
+	if resp.AssistantMessage == nil || resp.AssistantMessage.Content != fakeReply {
+		t.Fatalf("assistant message = %+v", resp.AssistantMessage)
+	}
+	audio := resp.AssistantMessage.Audio
+	if audio == nil || audio.ContentType != "audio/wav" {
+		t.Fatalf("assistant audio = %+v", audio)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/chat/audio/"+audio.ID, nil)
+	req.Header.Set("X-Visitor-Token", visitor.VisitorToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "RIFF") {
+		t.Fatalf("get audio: %d %q", rec.Code, rec.Body.String()[:min(rec.Body.Len(), 16)])
+	}
+	if got := int64(rec.Body.Len()); got != audio.SizeBytes {
+		t.Fatalf("audio is %d bytes, response said %d", got, audio.SizeBytes)
+	}
+}
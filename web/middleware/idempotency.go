@@ -0,0 +1,401 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/models/db"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the response headers kept for replays; everything else
+// is set again by the middlewares in front of this one.
+var replayedHeaders = []string{"Cache-Control", "Content-Type"}
+
+// IdempotencyStore keeps the response of every request sent with an
+// Idempotency-Key in Postgres, and the responses still being written in
+// memory, so that retries neither run the request again nor lose a reply
+// that is still streaming.
+type IdempotencyStore struct {
+	queries     *db.Queries
+	enabled     bool
+	ttl         time.Duration
+	lockTimeout time.Duration
+	maxBody     int64
+
+	mu       sync.Mutex
+	inflight map[idempotencyKey]*recordedResponse
+}
+
+// idempotencyKey is an Idempotency-Key as scoped to the visitor sending it,
+// so visitors cannot see or block each other's requests.
+type idempotencyKey struct {
+	visitor uuid.UUID
+	key     string
+}
+
+func (k idempotencyKey) pgVisitor() pgtype.UUID {
+	return pgtype.UUID{Bytes: k.visitor, Valid: true}
+}
+
+func NewIdempotencyStore(cfg *config.Config, queries *db.Queries) *IdempotencyStore {
+	ttl := time.Duration(cfg.IdempotencyTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	// A request still in progress after this long went down with its
+	// instance, and its key may be claimed again.
+	lockTimeout := 10 * time.Minute
+	if cfg.AIStreamMaxSeconds > 0 {
+		lockTimeout = time.Duration(cfg.AIStreamMaxSeconds)*time.Second + time.Minute
+	}
+	return &IdempotencyStore{
+		queries:     queries,
+		enabled:     cfg.IdempotencyEnabled,
+		ttl:         ttl,
+		lockTimeout: lockTimeout,
+		maxBody:     max(cfg.AttachmentsMaxBytes*int64(cfg.AttachmentsMaxCount), cfg.SpeechMaxAudioBytes) + 1<<20,
+		inflight:    map[idempotencyKey]*recordedResponse{},
+	}
+}
+
+// IdempotencyMiddleware runs a request once per Idempotency-Key. Replays with
+// the same body get the original response, or follow it while it is still
+// being written on this instance; replays with a different body get 422.
+func IdempotencyMiddleware(store *IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		visitor := VisitorID(c)
+		if store == nil || !store.enabled || key == "" || visitor == uuid.Nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid Idempotency-Key"})
+			return
+		}
+
+		hash, err := store.requestHash(c)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		id := idempotencyKey{visitor: visitor, key: key}
+		now := time.Now()
+		_, err = store.queries.ClaimIdempotencyKey(c.Request.Context(), db.ClaimIdempotencyKeyParams{
+			VisitorUuid: id.pgVisitor(),
+			Key:         key,
+			RequestHash: hash,
+			LockedUntil: pgtype.Timestamptz{Time: now.Add(store.lockTimeout), Valid: true},
+			ExpiresAt:   pgtype.Timestamptz{Time: now.Add(store.ttl), Valid: true},
+		})
+		switch {
+		case err == nil:
+			store.run(c, id)
+		case errors.Is(err, pgx.ErrNoRows):
+			store.replay(c, id, hash)
+		case isForeignKeyViolation(err):
+			// The token is valid but its visitor was deleted; the handlers
+			// answer the same.
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown visitor"})
+		default:
+			log.Printf("idempotency claim error: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check idempotency key"})
+		}
+	}
+}
+
+// foreignKeyViolation is the SQLSTATE of a foreign_key_violation.
+const foreignKeyViolation = "23503"
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+// requestHash fingerprints the visitor, route, query and body. The body is
+// buffered and put back for the handler.
+func (s *IdempotencyStore) requestHash(c *gin.Context) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, s.maxBody))
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Multipart boundaries are random per attempt.
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s %s?%s\n", VisitorID(c), c.Request.Method, c.FullPath(), c.Request.URL.Query().Encode())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// run executes the request and keeps its response. Responses worth retrying
+// (5xx, 409, 429 or errors recorded on the context) release the key instead.
+// The request keeps running when the client goes away, so that a retry can
+// pick up its reply.
+func (s *IdempotencyStore) run(c *gin.Context, id idempotencyKey) {
+	rec := newRecordedResponse()
+	s.mu.Lock()
+	s.inflight[id] = rec
+	s.mu.Unlock()
+	defer func() {
+		rec.finish()
+		s.mu.Lock()
+		delete(s.inflight, id)
+		s.mu.Unlock()
+	}()
+
+	writer := &recordingWriter{ResponseWriter: c.Writer, rec: rec}
+	c.Writer = writer
+	c.Request = c.Request.WithContext(context.WithoutCancel(c.Request.Context()))
+	c.Next()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	status := writer.Status()
+	if status >= 500 || status == http.StatusConflict || status == http.StatusTooManyRequests || len(c.Errors) > 0 {
+		if err := s.queries.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{
+			VisitorUuid: id.pgVisitor(),
+			Key:         id.key,
+		}); err != nil {
+			log.Printf("idempotency release error: %v", err)
+		}
+		return
+	}
+
+	headers, err := json.Marshal(keptHeaders(writer.Header()))
+	if err != nil {
+		log.Printf("idempotency store error: %v", err)
+		return
+	}
+	if err := s.queries.CompleteIdempotencyKey(ctx, db.CompleteIdempotencyKeyParams{
+		VisitorUuid:     id.pgVisitor(),
+		Key:             id.key,
+		ResponseStatus:  pgtype.Int4{Int32: int32(status), Valid: true},
+		ResponseHeaders: headers,
+		ResponseBody:    rec.bytes(),
+	}); err != nil {
+		log.Printf("idempotency store error: %v", err)
+	}
+}
+
+func (s *IdempotencyStore) replay(c *gin.Context, id idempotencyKey, hash string) {
+	defer c.Abort()
+	ctx := c.Request.Context()
+	// The second round covers a request that finished between the claim and
+	// the lookup of its recording.
+	for range 2 {
+		row, err := s.queries.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+			VisitorUuid: id.pgVisitor(),
+			Key:         id.key,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			log.Printf("idempotency lookup error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check idempotency key"})
+			return
+		}
+		if row.RequestHash != hash {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			return
+		}
+		if row.Status == "completed" {
+			writeStoredResponse(c, row)
+			return
+		}
+
+		s.mu.Lock()
+		rec := s.inflight[id]
+		s.mu.Unlock()
+		if rec != nil {
+			rec.follow(c)
+			return
+		}
+	}
+
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+}
+
+func writeStoredResponse(c *gin.Context, row db.IdempotencyKey) {
+	var header http.Header
+	if err := json.Unmarshal(row.ResponseHeaders, &header); err != nil {
+		log.Printf("idempotency replay error: %v", err)
+	}
+	for name, values := range header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(int(row.ResponseStatus.Int32), header.Get("Content-Type"), row.ResponseBody)
+}
+
+func keptHeaders(header http.Header) http.Header {
+	kept := http.Header{}
+	for _, name := range replayedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			kept[name] = values
+		}
+	}
+	return kept
+}
+
+// recordedResponse is a response as far as it has been written.
+type recordedResponse struct {
+	mu      sync.Mutex
+	started bool
+	status  int
+	header  http.Header
+	body    []byte
+	done    bool
+	changed chan struct{}
+}
+
+func newRecordedResponse() *recordedResponse {
+	return &recordedResponse{changed: make(chan struct{})}
+}
+
+func (r *recordedResponse) start(status int, header http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return
+	}
+	r.started = true
+	r.status = status
+	r.header = keptHeaders(header)
+	r.notify()
+}
+
+func (r *recordedResponse) write(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.body = append(r.body, b...)
+	r.notify()
+}
+
+func (r *recordedResponse) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.notify()
+}
+
+func (r *recordedResponse) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body
+}
+
+func (r *recordedResponse) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// follow writes what has been recorded so far and then everything the
+// original request writes, until it is done or this client goes away.
+func (r *recordedResponse) follow(c *gin.Context) {
+	sent := 0
+	headerSent := false
+	for {
+		r.mu.Lock()
+		started, status, header := r.started, r.status, r.header
+		chunk, done, changed := r.body[sent:], r.done, r.changed
+		r.mu.Unlock()
+
+		if started && !headerSent {
+			for name, values := range header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Status(status)
+			c.Writer.WriteHeaderNow()
+			headerSent = true
+		}
+		if len(chunk) > 0 {
+			if _, err := c.Writer.Write(chunk); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			sent += len(chunk)
+		}
+		if done {
+			if !headerSent {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "request failed"})
+			}
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// recordingWriter copies everything written to the response into a
+// recordedResponse. Once the client is gone it keeps recording and reports
+// success, so the handler finishes the reply for a retry to pick up.
+type recordingWriter struct {
+	gin.ResponseWriter
+	rec  *recordedResponse
+	gone bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.rec.start(w.Status(), w.Header())
+	w.rec.write(b)
+	if !w.gone {
+		if _, err := w.ResponseWriter.Write(b); err != nil {
+			w.gone = true
+		}
+	}
+	return len(b), nil
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *recordingWriter) WriteHeaderNow() {
+	w.rec.start(w.Status(), w.Header())
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *recordingWriter) Flush() {
+	w.rec.start(w.Status(), w.Header())
+	if !w.gone {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/models/db"
+)
+
+// failingDB fails every query with err.
+type failingDB struct {
+	err error
+}
+
+func (d failingDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, d.err
+}
+
+func (d failingDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, d.err
+}
+
+func (d failingDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return failingRow(d)
+}
+
+type failingRow failingDB
+
+func (r failingRow) Scan(...any) error {
+	return r.err
+}
+
+func TestIdempotencyClaimErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "deleted visitor", err: &pgconn.PgError{Code: foreignKeyViolation}, status: http.StatusUnauthorized},
+		{name: "other error", err: &pgconn.PgError{Code: "57014"}, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewIdempotencyStore(&config.Config{IdempotencyEnabled: true}, db.New(failingDB{err: tt.err}))
+			router := gin.New()
+			router.POST("/chat", func(c *gin.Context) {
+				c.Set(visitorContextKey, uuid.New())
+			}, IdempotencyMiddleware(store), func(c *gin.Context) {
+				t.Error("handler ran")
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"message":"hi"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "key-1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
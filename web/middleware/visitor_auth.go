@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/visitortoken"
+)
+
+const (
+	visitorCookieName = "visitor_token"
+	visitorContextKey = "visitor_uuid"
+)
+
+var errNoVisitorToken = errors.New("visitor token required")
+
+// VisitorAuth reads signed visitor tokens from the X-Visitor-Token header or
+// the visitor_token cookie and issues new ones.
+type VisitorAuth struct {
+	signer   *visitortoken.Signer
+	secure   bool
+	httpOnly bool
+	sameSite http.SameSite
+	domain   string
+	maxAge   int
+}
+
+func NewVisitorAuth(cfg *config.Config, signer *visitortoken.Signer) (*VisitorAuth, error) {
+	var sameSite http.SameSite
+	switch strings.ToLower(strings.TrimSpace(cfg.VisitorCookieSameSite)) {
+	case "", "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown VISITOR_COOKIE_SAME_SITE %q", cfg.VisitorCookieSameSite)
+	}
+	return &VisitorAuth{
+		signer:   signer,
+		secure:   cfg.VisitorCookieSecure,
+		httpOnly: cfg.VisitorCookieHTTPOnly,
+		sameSite: sameSite,
+		domain:   cfg.VisitorCookieDomain,
+		maxAge:   cfg.VisitorCookieMaxAgeDays * 24 * 60 * 60,
+	}, nil
+}
+
+// Lookup returns the visitor of the request's token. Tokens signed with an
+// older key are reissued.
+func (a *VisitorAuth) Lookup(c *gin.Context) (uuid.UUID, error) {
+	token := strings.TrimSpace(c.GetHeader("X-Visitor-Token"))
+	if token == "" {
+		token, _ = c.Cookie(visitorCookieName)
+	}
+	if token == "" {
+		return uuid.Nil, errNoVisitorToken
+	}
+	visitor, stale, err := a.signer.Verify(token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if stale {
+		a.Issue(c, visitor)
+	}
+	return visitor, nil
+}
+
+// Issue signs a token for visitor, sends it as cookie and X-Visitor-Token
+// header and returns it.
+func (a *VisitorAuth) Issue(c *gin.Context, visitor uuid.UUID) string {
+	token := a.signer.Sign(visitor)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   a.domain,
+		MaxAge:   a.maxAge,
+		Secure:   a.secure,
+		HttpOnly: a.httpOnly,
+		SameSite: a.sameSite,
+	})
+	c.Header("X-Visitor-Token", token)
+	return token
+}
+
+// VisitorAuthMiddleware rejects requests without a valid visitor token with
+// 401 and makes the visitor available through VisitorID.
+func VisitorAuthMiddleware(auth *VisitorAuth) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		visitor, err := auth.Lookup(c)
+		if err != nil {
+			message := "invalid visitor token"
+			if errors.Is(err, errNoVisitorToken) {
+				message = err.Error()
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+			return
+		}
+		c.Set(visitorContextKey, visitor)
+		c.Next()
+	}
+}
+
+// VisitorID returns the visitor authenticated by VisitorAuthMiddleware, or
+// uuid.Nil.
+func VisitorID(c *gin.Context) uuid.UUID {
+	value, _ := c.Get(visitorContextKey)
+	visitor, _ := value.(uuid.UUID)
+	return visitor
+}
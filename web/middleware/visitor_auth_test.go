@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/visitortoken"
+)
+
+const testTokenSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestVisitorAuth(t *testing.T, cfg *config.Config) (*VisitorAuth, error) {
+	t.Helper()
+	cfg.VisitorTokenKeys = map[string]string{"test": testTokenSecret}
+	signer, err := visitortoken.NewSigner(cfg)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return NewVisitorAuth(cfg, signer)
+}
+
+func TestIssueCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		sameSite http.SameSite
+		err      bool
+	}{
+		{name: "defaults", cfg: config.Config{VisitorCookieSecure: true, VisitorCookieHTTPOnly: true}, sameSite: http.SameSiteLaxMode},
+		{name: "lax", cfg: config.Config{VisitorCookieSameSite: "Lax"}, sameSite: http.SameSiteLaxMode},
+		{name: "strict", cfg: config.Config{VisitorCookieSameSite: "strict", VisitorCookieSecure: true}, sameSite: http.SameSiteStrictMode},
+		{name: "none", cfg: config.Config{VisitorCookieSameSite: " none ", VisitorCookieSecure: true, VisitorCookieHTTPOnly: true}, sameSite: http.SameSiteNoneMode},
+		{name: "domain and max age", cfg: config.Config{VisitorCookieDomain: "example.com", VisitorCookieMaxAgeDays: 2}, sameSite: http.SameSiteLaxMode},
+		{name: "unknown same site", cfg: config.Config{VisitorCookieSameSite: "sometimes"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			auth, err := newTestVisitorAuth(t, &cfg)
+			if tt.err {
+				if err == nil {
+					t.Fatal("NewVisitorAuth succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewVisitorAuth: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			token := auth.Issue(c, uuid.New())
+
+			if got := rec.Header().Get("X-Visitor-Token"); got != token {
+				t.Fatalf("X-Visitor-Token = %q, want %q", got, token)
+			}
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies, want 1", len(cookies))
+			}
+			cookie := cookies[0]
+			if cookie.Name != visitorCookieName || cookie.Value != token || cookie.Path != "/" {
+				t.Fatalf("cookie = %s=%s path %q", cookie.Name, cookie.Value, cookie.Path)
+			}
+			if cookie.SameSite != tt.sameSite {
+				t.Errorf("SameSite = %v, want %v", cookie.SameSite, tt.sameSite)
+			}
+			if cookie.Secure != cfg.VisitorCookieSecure {
+				t.Errorf("Secure = %v, want %v", cookie.Secure, cfg.VisitorCookieSecure)
+			}
+			if cookie.HttpOnly != cfg.VisitorCookieHTTPOnly {
+				t.Errorf("HttpOnly = %v, want %v", cookie.HttpOnly, cfg.VisitorCookieHTTPOnly)
+			}
+			if cookie.Domain != cfg.VisitorCookieDomain {
+				t.Errorf("Domain = %q, want %q", cookie.Domain, cfg.VisitorCookieDomain)
+			}
+			if want := cfg.VisitorCookieMaxAgeDays * 24 * 60 * 60; cookie.MaxAge != want {
+				t.Errorf("MaxAge = %d, want %d", cookie.MaxAge, want)
+			}
+		})
+	}
+}
+
+func TestVisitorAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth, err := newTestVisitorAuth(t, &config.Config{})
+	if err != nil {
+		t.Fatalf("NewVisitorAuth: %v", err)
+	}
+	visitor := uuid.New()
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	token := auth.Issue(c, visitor)
+
+	router := gin.New()
+	router.GET("/", VisitorAuthMiddleware(auth), func(c *gin.Context) {
+		c.String(http.StatusOK, VisitorID(c).String())
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		status int
+	}{
+		{name: "header", header: token, status: http.StatusOK},
+		{name: "cookie", cookie: token, status: http.StatusOK},
+		{name: "missing", status: http.StatusUnauthorized},
+		{name: "invalid", header: token + "x", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Visitor-Token", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: visitorCookieName, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != visitor.String() {
+				t.Fatalf("visitor = %q, want %s", rec.Body.String(), visitor)
+			}
+		})
+	}
+}
+
+func TestLookupReissuesStaleToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	old, err := visitortoken.NewSigner(&config.Config{VisitorTokenKeys: map[string]string{"old": testTokenSecret}})
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	cfg := &config.Config{
+		VisitorTokenKeys:  map[string]string{"old": testTokenSecret, "new": "fedcba9876543210fedcba9876543210"},
+		VisitorTokenKeyID: "new",
+	}
+	signer, err := visitortoken.NewSigner(cfg)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	auth, err := NewVisitorAuth(cfg, signer)
+	if err != nil {
+		t.Fatalf("NewVisitorAuth: %v", err)
+	}
+
+	visitor := uuid.New()
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("X-Visitor-Token", old.Sign(visitor))
+	got, err := auth.Lookup(c)
+	if err != nil || got != visitor {
+		t.Fatalf("Lookup = %s, %v, want %s", got, err, visitor)
+	}
+	if token := rec.Header().Get("X-Visitor-Token"); token != signer.Sign(visitor) {
+		t.Fatalf("reissued token = %q, want one signed with the new key", token)
+	}
+}
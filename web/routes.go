@@ -17,8 +17,9 @@ func (s *Server) makeRoutes() *gin.Engine {
 	eng.Use(gin.Logger())
 	eng.Use(s.getCorsMiddleware())
 
+	emotionHandlers := handlers.NewEmotionHandler(s.emotionAssets, s.aiClient.Emotions(), s.cfg)
 	eng.Static("/assets", "./assets")
-	eng.Static("/emotions", "./assets/emotions")
+	eng.GET("/emotions/*filepath", emotionHandlers.HandleAsset)
 
 	eng.GET("/healthz", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -43,11 +44,53 @@ func (s *Server) makeRoutes() *gin.Engine {
 
 	apiV1 := eng.Group("/api/v1")
 	apiV1.Use(middleware.RateLimitMiddleware(s.limiter))
-	chatHandlers := handlers.NewChatHandler(s.dbQueries, s.aiClient, s.cfg)
+	chatHandlers := handlers.NewChatHandler(s.dbQueries, s.aiClient, s.store, s.stt, s.tts, s.locker, s.labeler, s.events, s.visitorAuth, s.cfg)
 	chatGroup := apiV1.Group("/chat")
+	chatGroup.Use(middleware.VisitorAuthMiddleware(s.visitorAuth))
 	apiV1.POST("/visitors", chatHandlers.HandleCreateVisitor)
-	chatGroup.POST("/messages", chatHandlers.HandleSendMessage)
+	apiV1.GET("/emotions", emotionHandlers.HandleManifest)
+	idempotency := middleware.IdempotencyMiddleware(s.idempotency)
+	chatGroup.POST("/messages", idempotency, chatHandlers.HandleSendMessage)
+	chatGroup.POST("/voice", idempotency, chatHandlers.HandleSendVoiceMessage)
+	chatGroup.POST("/messages/:message_id/regenerate", chatHandlers.HandleRegenerateReply)
+	chatGroup.POST("/messages/:message_id/edit", chatHandlers.HandleEditMessage)
+	chatGroup.GET("/messages/:message_id/alternatives", chatHandlers.HandleGetAlternatives)
+	chatGroup.POST("/messages/:message_id/activate", chatHandlers.HandleActivateMessage)
+	chatGroup.POST("/messages/:message_id/feedback", chatHandlers.HandleSubmitFeedback)
+	chatGroup.DELETE("/messages/:message_id/feedback", chatHandlers.HandleDeleteFeedback)
 	chatGroup.GET("/threads/:thread_id/messages", chatHandlers.HandleGetMessages)
+	chatGroup.GET("/threads/:thread_id/events", chatHandlers.HandleThreadEvents)
+	chatGroup.GET("/attachments/:attachment_id", chatHandlers.HandleGetAttachment)
+	chatGroup.GET("/audio/:audio_id", chatHandlers.HandleGetAudio)
+
+	meGroup := apiV1.Group("/visitors/me")
+	meGroup.Use(middleware.VisitorAuthMiddleware(s.visitorAuth))
+	meGroup.GET("/threads", chatHandlers.HandleListThreads)
+	meGroup.PATCH("/threads/:thread_id", chatHandlers.HandleUpdateThread)
+	meGroup.DELETE("/threads/:thread_id", chatHandlers.HandleDeleteThread)
+
+	// The admin API has its own group outside the public, rate limited
+	// /api/v1 routes.
+	adminHandlers := handlers.NewAdminHandler(s.dbQueries, s.aiClient, s.labeler, s.events, s.locker, s.store, s.emotionAssets, s.cfg)
+	adminGroup := eng.Group("/admin/api")
+	adminGroup.Use(middleware.AdminAuthMiddleware(s.cfg.AdminAPIToken))
+	adminGroup.GET("/visitors", adminHandlers.HandleListVisitors)
+	adminGroup.GET("/threads", adminHandlers.HandleListThreads)
+	adminGroup.GET("/threads/:thread_id", adminHandlers.HandleGetThread)
+	adminGroup.DELETE("/threads/:thread_id", adminHandlers.HandleDeleteThread)
+	adminGroup.POST("/threads/:thread_id/flag", adminHandlers.HandleFlagThread)
+	adminGroup.DELETE("/threads/:thread_id/flag", adminHandlers.HandleUnflagThread)
+	adminGroup.POST("/threads/:thread_id/labels", adminHandlers.HandleRelabelThread)
+	adminGroup.POST("/threads/:thread_id/takeover", adminHandlers.HandleStartTakeover)
+	adminGroup.DELETE("/threads/:thread_id/takeover", adminHandlers.HandleEndTakeover)
+	adminGroup.POST("/threads/:thread_id/messages", adminHandlers.HandleSendHumanMessage)
+	adminGroup.GET("/messages/:message_id/prompt", adminHandlers.HandleGetPrompt)
+	adminGroup.POST("/messages/:message_id/prompt/replay", adminHandlers.HandleReplayPrompt)
+	adminGroup.GET("/search", adminHandlers.HandleSearchMessages)
+	adminGroup.GET("/feedback/stats", adminHandlers.HandleFeedbackStats)
+	adminGroup.GET("/emotions", adminHandlers.HandleListEmotions)
+	adminGroup.PUT("/emotions/:name", adminHandlers.HandlePutEmotion)
+	adminGroup.DELETE("/emotions/:name", adminHandlers.HandleDeleteEmotion)
 
 	return eng
 }
@@ -59,12 +102,18 @@ func (s *Server) getCorsMiddleware() gin.HandlerFunc {
 		"Accept",
 		"Authorization",
 		"Content-Type",
+		"Idempotency-Key",
+		"If-None-Match",
 		"User-Agent",
 		"x-requested-with",
-		"X-Visitor-Id",
+		"X-Visitor-Token",
 	}
 	cfg.ExposeHeaders = []string{
-		"X-Visitor-Id",
+		"ETag",
+		"Idempotent-Replayed",
+		"X-Visitor-Token",
 	}
+	// The visitor token cookie is sent cross-origin.
+	cfg.AllowCredentials = true
 	return cors.New(cfg)
 }
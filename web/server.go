@@ -3,27 +3,45 @@ package web
 import (
 	"context"
 	"fmt"
+	"log"
 	"net"
 	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"talk-to-ugur-back/ai"
 	"talk-to-ugur-back/config"
+	"talk-to-ugur-back/emotion"
 	"talk-to-ugur-back/models"
-	"talk-to-ugur-back/models/db"
+	"talk-to-ugur-back/speech"
+	"talk-to-ugur-back/storage"
+	"talk-to-ugur-back/threadevents"
+	"talk-to-ugur-back/threadlabel"
+	"talk-to-ugur-back/threadlock"
+	"talk-to-ugur-back/visitortoken"
+	"talk-to-ugur-back/web/handlers"
 	"talk-to-ugur-back/web/middleware"
 )
 
 type Server struct {
-	dbQueries *db.Queries
-	pgPool    *pgxpool.Pool
-	cfg       *config.Config
-	aiClient  *ai.Client
-	limiter   *middleware.RateLimiter
-	startTime time.Time
-	ready     atomic.Bool
+	dbQueries     *models.Store
+	pgPool        *pgxpool.Pool
+	cfg           *config.Config
+	aiClient      *ai.Client
+	emotionAssets *emotion.Catalog
+	store         storage.Store
+	stt           speech.Transcriber
+	tts           speech.Synthesizer
+	locker        threadlock.Locker
+	labeler       threadlabel.Labeler
+	events        threadevents.Bus
+	limiter       *middleware.RateLimiter
+	idempotency   *middleware.IdempotencyStore
+	visitorAuth   *middleware.VisitorAuth
+	startTime     time.Time
+	ready         atomic.Bool
 }
 
 func NewServer(ctx context.Context) (*Server, error) {
@@ -32,6 +50,11 @@ func NewServer(ctx context.Context) (*Server, error) {
 		return nil, err
 	}
 
+	emotionAssets, err := emotion.LoadCatalog(cfg.AIEmotionAssetsDir)
+	if err != nil {
+		return nil, fmt.Errorf("load emotion assets: %w", err)
+	}
+
 	pgConfig, err := pgxpool.ParseConfig(cfg.PostgresConnString)
 	if err != nil {
 		return nil, err
@@ -62,17 +85,68 @@ func NewServer(ctx context.Context) (*Server, error) {
 		return nil, err
 	}
 
-	queries := db.New(pgPool)
-	aiClient := ai.NewClient(cfg)
+	queries := models.NewStore(pgPool)
+	aiClient, err := ai.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = handlers.LoadEmotions(ctx, queries.Queries, aiClient.Emotions()); err != nil {
+		return nil, fmt.Errorf("load emotions: %w", err)
+	}
+	if err = emotionAssets.Validate(aiClient.Emotions().Names(), cfg.AIEmotionFallbacks, cfg.AIEmotionDefaultFallback); err != nil {
+		return nil, fmt.Errorf("emotion assets: %w", err)
+	}
+	store, err := storage.NewStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stt, err := speech.NewTranscriber(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tts, err := speech.NewSynthesizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	locker, err := threadlock.New(cfg, pgPool)
+	if err != nil {
+		return nil, err
+	}
+	labeler, err := threadlabel.New(cfg, aiClient)
+	if err != nil {
+		return nil, err
+	}
+	events, err := threadevents.New(ctx, cfg, pgPool)
+	if err != nil {
+		return nil, err
+	}
 	limiter := middleware.NewRateLimiter(cfg)
+	idempotency := middleware.NewIdempotencyStore(cfg, queries.Queries)
+	signer, err := visitortoken.NewSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	visitorAuth, err := middleware.NewVisitorAuth(cfg, signer)
+	if err != nil {
+		return nil, err
+	}
 
 	server := &Server{
-		dbQueries: queries,
-		pgPool:    pgPool,
-		cfg:       cfg,
-		aiClient:  aiClient,
-		limiter:   limiter,
-		startTime: time.Now(),
+		dbQueries:     queries,
+		pgPool:        pgPool,
+		cfg:           cfg,
+		aiClient:      aiClient,
+		emotionAssets: emotionAssets,
+		store:         store,
+		stt:           stt,
+		tts:           tts,
+		locker:        locker,
+		labeler:       labeler,
+		events:        events,
+		limiter:       limiter,
+		idempotency:   idempotency,
+		visitorAuth:   visitorAuth,
+		startTime:     time.Now(),
 	}
 	return server, nil
 }
@@ -86,6 +160,16 @@ func (s *Server) Run(ctx context.Context) error {
 
 	s.ready.Store(true)
 
+	if s.cfg.AIPromptCaptureEnabled && s.cfg.AIPromptCaptureRetentionDays > 0 {
+		go s.prunePrompts(ctx)
+	}
+
+	go s.refreshEmotions(ctx)
+
+	if s.cfg.IdempotencyEnabled {
+		go s.pruneIdempotencyKeys(ctx)
+	}
+
 	go func() {
 		<-ctx.Done()
 		_ = listener.Close()
@@ -93,3 +177,66 @@ func (s *Server) Run(ctx context.Context) error {
 
 	return eng.RunListener(listener)
 }
+
+// prunePrompts deletes captured prompts older than the retention period once
+// an hour until ctx is done.
+func (s *Server) prunePrompts(ctx context.Context) {
+	retention := time.Duration(s.cfg.AIPromptCaptureRetentionDays) * 24 * time.Hour
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		cutoff := pgtype.Timestamptz{Time: time.Now().Add(-retention), Valid: true}
+		if deleted, err := s.dbQueries.DeleteChatPromptsBefore(ctx, cutoff); err != nil {
+			log.Printf("prompt retention error: %v", err)
+		} else if deleted > 0 {
+			log.Printf("prompt retention: deleted %d prompts", deleted)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pruneIdempotencyKeys deletes expired idempotency keys once an hour until ctx
+// is done.
+func (s *Server) pruneIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		if deleted, err := s.dbQueries.DeleteIdempotencyKeysBefore(ctx, now); err != nil {
+			log.Printf("idempotency retention error: %v", err)
+		} else if deleted > 0 {
+			log.Printf("idempotency retention: deleted %d keys", deleted)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshEmotions reloads the emotion set every minute so that changes made
+// through the admin API on another instance are picked up.
+func (s *Server) refreshEmotions(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := handlers.LoadEmotions(ctx, s.dbQueries.Queries, s.aiClient.Emotions()); err != nil {
+			log.Printf("emotion refresh error: %v", err)
+		}
+	}
+}